@@ -0,0 +1,5 @@
+package constraints
+
+func Plain(v int) int {
+	return v + 1
+}
@@ -0,0 +1,9 @@
+package constraints
+
+func Windows(v int) int {
+	if v > 0 {
+		return v
+	}
+
+	return -v
+}
@@ -0,0 +1,7 @@
+//go:build integration
+
+package constraints
+
+func Tagged(v int) int {
+	return v * 2
+}
@@ -0,0 +1,40 @@
+package flow
+
+func empty() {}
+
+func flow(v int, ch chan int) int {
+	if v < 0 {
+		return -1
+	} else if v == 0 {
+		return 0
+	} else {
+		v++
+	}
+
+	switch v {
+	case 1:
+		v++
+	default:
+	}
+
+	select {
+	case <-ch:
+		v--
+	}
+
+	f := func() int {
+		return v
+	}
+
+loop:
+	v += f()
+	if v < 10 {
+		goto loop
+	}
+
+	if v > 100 {
+		panic("too big")
+	}
+
+	return v
+}
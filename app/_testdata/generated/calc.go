@@ -0,0 +1,6 @@
+package calc
+
+// Sum returns sum of values.
+func Sum(a, b int) int {
+	return a + b
+}
@@ -0,0 +1,9 @@
+package a
+
+func A(v int) int {
+	if v > 0 {
+		return v
+	}
+
+	return -v
+}
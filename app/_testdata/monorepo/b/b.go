@@ -0,0 +1,9 @@
+package b
+
+func B(v int) bool {
+	if v > 0 {
+		return true
+	}
+
+	return false
+}
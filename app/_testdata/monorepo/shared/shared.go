@@ -0,0 +1,9 @@
+package shared
+
+func Shared(v int) int {
+	if v > 0 {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,24 @@
+package moved
+
+// Square returns area of square.
+func Square(a int) int {
+	return a * a
+}
+
+// Area returns area of rectangle, negative sides are not allowed.
+func Area(w, h int) int {
+    if w < 0 || h < 0 {
+        return 0
+    }
+
+    return w * h
+}
+
+// Perimeter returns perimeter of rectangle.
+func Perimeter(w, h int) int {
+	if w < 0 || h < 0 {
+		return 0
+	}
+
+	return 2 * (w + h)
+}
@@ -0,0 +1,17 @@
+package sem
+
+import "sync"
+
+func Reorder(mu *sync.Mutex) {
+	mu.Unlock()
+	mu.Lock()
+}
+
+func Unnest(a int) int {
+	if a > 0 {
+		a++
+	}
+	a--
+
+	return a
+}
@@ -0,0 +1,35 @@
+package sem
+
+import "fmt"
+
+// Sum returns sum of a and b.
+func Sum(a, b int) int {
+	return a + b // Plain sum.
+}
+
+func Print(items []string) {
+	for _, i := range items {
+		fmt.Println(
+			"item:",
+			i,
+			len(items),
+		)
+	}
+}
+
+func Check(a int) error {
+	if a >= 0 {
+		return nil
+	}
+
+	return fmt.Errorf("bad %d", a)
+}
+
+func Loop(n int) int {
+	s := 0
+	for i := 0; i < n; i++ {
+		s += i
+	}
+	s += 1
+	return s
+}
@@ -0,0 +1,445 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// analysis is a coverage of changed lines.
+type analysis struct {
+	mapper   *pathMapper
+	diff     *unifiedDiff
+	profiles *profileSet
+
+	// modified maps changed files to blocks of changed lines, count of -1 means no block.
+	modified      map[string]map[int]*profileBlock
+	changedFiles  []string
+	testedFiles   map[string]bool
+	fileCoverage  map[string]stat
+	changedBlocks map[string][]profileBlock
+
+	// mismatches maps changed files missing in profiles to diagnostics of path mismatch.
+	mismatches map[string]string
+	// notBuilt is a set of changed files excluded by build constraints of test run configuration.
+	notBuilt map[string]bool
+	// stale maps changed files to descriptions of profile blocks that do not match current sources.
+	stale map[string]string
+	// profileBlocks are merged profile blocks of changed files.
+	profileBlocks map[string][]profileBlock
+	// moved maps files to blocks of moved code that are not counted as changed.
+	moved map[string][]*movedBlock
+	// deletions maps changed files to lines of new version that are followed by removed lines without replacement.
+	deletions map[string][]int
+	// generated are changed files with generated code that are skipped.
+	generated []string
+
+	totStmt, covStmt int
+	totHits          stat
+
+	countMode bool
+	minHits   int
+}
+
+// analyze maps coverage profiles to changed lines.
+func analyze(f flags) (*analysis, error) {
+	if f.root == "" {
+		f.root = repoRoot()
+	}
+
+	rules, err := loadRewriteRules(f.pathRewrite, f.pathRewriteFile)
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := newPathMapper(f.root, f.module, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := getDiff(f)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range diff.submodules {
+		mapper.addSubmodule(dir)
+	}
+
+	modified := map[string]map[int]*profileBlock{}
+	exclude := []string(nil)
+
+	if f.exclude != "" {
+		exclude = strings.Split(f.exclude, ",")
+	}
+
+	semantic := f.semantic
+	includeGenerated := f.includeGenerated
+	formattingOnly := 0
+	deletions := map[string][]int{}
+
+	var moved map[string][]*movedBlock
+	if f.movedCode != movedKeep {
+		moved = detectMoved(diff)
+	}
+
+	var generated []string
+
+	for _, f := range diff.files {
+		// Moved code is only reported for analyzed files.
+		if !strings.HasSuffix(f.newName, ".go") || strings.HasSuffix(f.newName, "_test.go") || isExcluded(f.newName, exclude) {
+			delete(moved, f.newName)
+
+			continue
+		}
+
+		if !includeGenerated && isGenerated(mapper.filePath(f.newName)) {
+			generated = append(generated, f.newName)
+			delete(moved, f.newName)
+
+			continue
+		}
+
+		lines := map[int]*profileBlock{}
+
+		for _, h := range f.hunks {
+			last := h.newStart - 1 // Last line of new version before current line.
+			if h.newLines == 0 {
+				last = h.newStart
+			}
+
+			for i, l := range h.lines {
+				if l.kind == lineRemoved {
+					// Removed lines that are replaced by added lines are changes of added lines.
+					if i+1 == len(h.lines) || h.lines[i+1].kind == lineContext {
+						deletions[f.newName] = append(deletions[f.newName], last)
+					}
+
+					continue
+				}
+
+				last = l.newNum
+
+				if l.kind == lineAdded {
+					lines[l.newNum] = &profileBlock{Count: -1}
+				}
+			}
+		}
+
+		if semantic && f.status != fileAdded {
+			unchanged, err := formattingOnlyLines(mapper.filePath(f.newName), f)
+			if err != nil {
+				log.Printf("semantic diff is not available for %s: %v", f.newName, err)
+			}
+
+			for l := range unchanged {
+				delete(lines, l)
+			}
+
+			formattingOnly += len(unchanged)
+		}
+
+		for _, mb := range moved[f.newName] {
+			for l := mb.startLine; l <= mb.endLine; l++ {
+				delete(lines, l)
+			}
+		}
+
+		// Files with deletions are kept to report functions modified by deletion only.
+		if len(lines) == 0 && len(deletions[f.newName]) == 0 && (semantic || len(moved[f.newName]) > 0) {
+			continue
+		}
+
+		modified[f.newName] = lines
+	}
+
+	if formattingOnly > 0 {
+		log.Printf("%d changed line(s) with formatting or comment changes only are ignored", formattingOnly)
+	}
+
+	// Only blocks of files with base names of changed files are kept to limit memory usage.
+	bases := map[string]bool{}
+	for fn := range modified {
+		bases[path.Base(fn)] = true
+	}
+
+	for fn := range moved {
+		bases[path.Base(fn)] = true
+	}
+
+	profiles, err := loadProfiles(f.covFile, func(fn string) bool {
+		return bases[path.Base(fn)]
+	}, func(fn string) string {
+		return mapper.filePath(mapper.repoPath(fn))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse profiles: %w", err)
+	}
+
+	changedFiles := make([]string, 0, len(modified))
+	for fn := range modified {
+		changedFiles = append(changedFiles, fn)
+	}
+
+	sort.Strings(changedFiles)
+	mapper.detectPrefix(profiles.files, changedFiles)
+
+	a := &analysis{
+		mapper:        mapper,
+		diff:          diff,
+		profiles:      profiles,
+		modified:      modified,
+		changedFiles:  changedFiles,
+		testedFiles:   map[string]bool{},
+		fileCoverage:  map[string]stat{},
+		changedBlocks: map[string][]profileBlock{},
+		mismatches:    map[string]string{},
+		notBuilt:      map[string]bool{},
+		stale:         map[string]string{},
+		profileBlocks: map[string][]profileBlock{},
+		moved:         moved,
+		deletions:     deletions,
+		generated:     generated,
+		countMode:     profiles.mode == "count" || profiles.mode == "atomic",
+	}
+
+	if a.countMode {
+		a.minHits = f.minHits
+	}
+
+	profiles.each(a.add)
+
+	for _, fn := range changedFiles {
+		blocks := a.profileBlocks[fn]
+		if len(blocks) == 0 {
+			continue
+		}
+
+		n, err := countStaleBlocks(mapper.filePath(fn), blocks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to validate profile blocks: %w", err)
+		}
+
+		if n > 0 {
+			a.stale[fn] = fmt.Sprintf("%d of %d block(s) do not match statements of current source", n, len(blocks))
+		}
+	}
+
+	pd := newPathDiagnostics(mapper, profiles.files)
+	ctx := buildContext(f.goos, f.goarch, f.tags)
+
+	// Statements of files missing in profiles are counted as not covered, unless files are not built and excluded.
+	// Suspected path mismatches are reported, but statements are still counted.
+	for _, fn := range changedFiles {
+		if a.testedFiles[fn] {
+			continue
+		}
+
+		built, err := isBuilt(ctx, mapper.filePath(fn))
+		if err != nil {
+			return nil, err
+		}
+
+		if !built {
+			a.notBuilt[fn] = true
+
+			if f.excludeNotBuilt {
+				continue
+			}
+		} else if mismatch := pd.diagnose(fn); mismatch != "" {
+			a.mismatches[fn] = mismatch
+		}
+
+		blocks, err := findBlocks(mapper.filePath(fn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find statements: %w", err)
+		}
+
+		for _, block := range blocks {
+			a.addBlock(fn, block)
+		}
+	}
+
+	// Statements of moved code in files missing in profiles are counted as not covered.
+	for fn := range moved {
+		if _, ok := modified[fn]; ok || a.testedFiles[fn] {
+			continue
+		}
+
+		blocks, err := findBlocks(mapper.filePath(fn))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find statements: %w", err)
+		}
+
+		for _, block := range blocks {
+			a.addBlock(fn, block)
+		}
+	}
+
+	return a, nil
+}
+
+// isExcluded checks if file is in excluded directory or matches excluded name pattern.
+func isExcluded(fn string, exclude []string) bool {
+	for _, e := range exclude {
+		if strings.HasPrefix(fn, e) {
+			return true
+		}
+
+		if ok, err := filepath.Match(e, filepath.Base(fn)); ok && err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skippedGenerated checks if changed file is skipped as generated code.
+func (a *analysis) skippedGenerated(fn string) bool {
+	for _, g := range a.generated {
+		if g == fn {
+			return true
+		}
+	}
+
+	return false
+}
+
+// add accounts a profile block that may overlap with changed lines.
+func (a *analysis) add(fn string, block profileBlock) {
+	fn = a.mapper.repoPath(fn)
+	a.testedFiles[fn] = true
+
+	if _, ok := a.modified[fn]; ok {
+		a.profileBlocks[fn] = append(a.profileBlocks[fn], block)
+	}
+
+	a.addBlock(fn, block)
+}
+
+// addBlock accounts a block of repository relative file name.
+func (a *analysis) addBlock(fn string, block profileBlock) {
+	for _, mb := range a.moved[fn] {
+		if block.StartLine <= mb.endLine && block.EndLine >= mb.startLine {
+			mb.totStmt += block.NumStmt
+
+			if block.Count > 0 {
+				mb.covStmt += block.NumStmt
+			}
+		}
+	}
+
+	fStat := a.fileCoverage[fn]
+	fStat.module = a.mapper.moduleOf(fn)
+
+	lines, ok := a.modified[fn]
+	if !ok {
+		return
+	}
+
+	totCounted := false
+	for i := block.StartLine; i <= block.EndLine; i++ {
+		l, ok := lines[i]
+		if !ok {
+			continue
+		}
+
+		if !totCounted {
+			a.totStmt += block.NumStmt
+			fStat.totStmt += block.NumStmt
+
+			if block.Count > 0 {
+				a.covStmt += block.NumStmt
+				fStat.covStmt += block.NumStmt
+			}
+
+			a.totHits.addHits(block, a.minHits)
+			fStat.addHits(block, a.minHits)
+			a.changedBlocks[fn] = append(a.changedBlocks[fn], block)
+
+			totCounted = true
+		}
+
+		if l.Count == -1 {
+			lines[i] = &block
+
+			continue
+		}
+
+		// Do not merge blocks that has coverage.
+		if block.Count > 0 {
+			continue
+		}
+
+		l.NumStmt += block.NumStmt
+
+		if l.StartLine == block.StartLine && l.StartCol > block.StartCol {
+			l.StartCol = block.StartCol
+		}
+
+		if l.StartLine > block.StartLine {
+			l.StartLine = block.StartLine
+			l.StartCol = block.StartCol
+		}
+
+		if l.EndLine == block.EndLine && l.EndCol < block.EndCol {
+			l.EndCol = block.EndCol
+		}
+
+		if l.EndLine < block.EndLine {
+			l.EndLine = block.EndLine
+			l.EndCol = block.EndCol
+		}
+	}
+
+	a.fileCoverage[fn] = fStat
+}
+
+// deletedIn reports whether lines are removed between lines of a range of new version.
+func (a *analysis) deletedIn(fn string, startLine, endLine int) bool {
+	for _, l := range a.deletions[fn] {
+		if startLine <= l && l < endLine {
+			return true
+		}
+	}
+
+	return false
+}
+
+// funcCoverage describes current coverage of all statements of a function.
+func (a *analysis) funcCoverage(fn string, fu *FuncExtent) string {
+	totStmt, covStmt := 0, 0
+
+	for _, b := range a.profileBlocks[fn] {
+		if b.StartLine >= fu.startLine && b.EndLine <= fu.endLine {
+			totStmt += b.NumStmt
+
+			if b.Count > 0 {
+				covStmt += b.NumStmt
+			}
+		}
+	}
+
+	cov := "no coverage"
+	if totStmt > 0 {
+		cov = fmt.Sprintf("%.1f%%", float64(covStmt)/float64(totStmt)*100)
+	}
+
+	return fmt.Sprintf("%s:%d %s %s", fn, fu.startLine, fu.name, cov)
+}
+
+// staleFiles returns sorted changed files with stale profile blocks.
+func (a *analysis) staleFiles() []string {
+	res := make([]string, 0, len(a.stale))
+
+	for _, fn := range a.changedFiles {
+		if a.stale[fn] != "" {
+			res = append(res, fn)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,394 @@
+// Copyright 2013 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the visitor that computes coverage blocks of a file
+// the same way as cmd/cover does when it instruments the source.
+// Blocks follow cmd/cover up to Go 1.25. Newer versions start blocks at the first
+// statement instead of the opening brace or condition, end them at the beginning
+// of the line after the last statement, and emit line ranges of a block around
+// blank and comment lines, each with statement count of the whole block.
+
+package app
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+)
+
+// findBlocks parses the file and returns its coverage blocks with zero counts.
+func findBlocks(name string) ([]profileBlock, error) {
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	fset := token.NewFileSet()
+
+	parsedFile, err := parser.ParseFile(fset, name, content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	visitor := &BlockVisitor{
+		fset:    fset,
+		content: content,
+	}
+	ast.Walk(visitor, parsedFile)
+
+	return visitor.blocks, nil
+}
+
+// BlockVisitor implements the visitor that builds the coverage block list for a file.
+type BlockVisitor struct {
+	fset    *token.FileSet
+	content []byte
+	blocks  []profileBlock
+}
+
+// Visit implements the ast.Visitor interface.
+func (v *BlockVisitor) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.BlockStmt:
+		// If it's a switch or select, the body is a list of case clauses; don't tag the block itself.
+		if len(n.List) > 0 {
+			switch n.List[0].(type) {
+			case *ast.CaseClause: // switch
+				for _, n := range n.List {
+					clause := n.(*ast.CaseClause)
+					v.addBlocks(clause.Colon+1, clause.Colon+1, clause.End(), clause.Body, false)
+				}
+
+				return v
+			case *ast.CommClause: // select
+				for _, n := range n.List {
+					clause := n.(*ast.CommClause)
+					v.addBlocks(clause.Colon+1, clause.Colon+1, clause.End(), clause.Body, false)
+				}
+
+				return v
+			}
+		}
+
+		v.addBlocks(n.Lbrace, n.Lbrace+1, n.Rbrace+1, n.List, true) // +1 to step past closing brace.
+	case *ast.IfStmt:
+		if n.Init != nil {
+			ast.Walk(v, n.Init)
+		}
+
+		ast.Walk(v, n.Cond)
+		ast.Walk(v, n.Body)
+
+		if n.Else == nil {
+			return nil
+		}
+
+		// The "else if" is covered as if it was wrapped in a block that starts after "else".
+		elseOffset := v.findText(n.Body.End(), "else")
+		if elseOffset < 0 {
+			return nil
+		}
+
+		pos := v.fset.File(n.Body.End()).Pos(elseOffset + 4)
+
+		switch stmt := n.Else.(type) {
+		case *ast.IfStmt:
+			ast.Walk(v, &ast.BlockStmt{
+				Lbrace: pos,
+				List:   []ast.Stmt{stmt},
+				Rbrace: stmt.End(),
+			})
+		case *ast.BlockStmt:
+			stmt.Lbrace = pos
+			ast.Walk(v, stmt)
+		}
+
+		return nil
+	case *ast.SelectStmt:
+		// An empty select is not instrumented.
+		if n.Body == nil || len(n.Body.List) == 0 {
+			return nil
+		}
+	case *ast.SwitchStmt:
+		// An empty switch is not instrumented.
+		if n.Body == nil || len(n.Body.List) == 0 {
+			if n.Init != nil {
+				ast.Walk(v, n.Init)
+			}
+
+			if n.Tag != nil {
+				ast.Walk(v, n.Tag)
+			}
+
+			return nil
+		}
+	case *ast.TypeSwitchStmt:
+		// An empty type switch is not instrumented.
+		if n.Body == nil || len(n.Body.List) == 0 {
+			if n.Init != nil {
+				ast.Walk(v, n.Init)
+			}
+
+			ast.Walk(v, n.Assign)
+
+			return nil
+		}
+	case *ast.FuncDecl:
+		// Functions with blank names and bodyless functions cannot be executed.
+		if n.Name.Name == "_" || n.Body == nil {
+			return nil
+		}
+	}
+
+	return v
+}
+
+// addBlocks adds a block for each basic block at the top level of the statement list.
+func (v *BlockVisitor) addBlocks(pos, insertPos, blockEnd token.Pos, list []ast.Stmt, extendToClosingBrace bool) {
+	// An empty block still has a counter.
+	if len(list) == 0 {
+		v.addBlock(insertPos, blockEnd, 0)
+
+		return
+	}
+
+	list = append([]ast.Stmt(nil), list...)
+
+	for {
+		// Find first statement that affects flow of control (break, continue, if, etc.).
+		// It will be the last statement of this basic block.
+		var last int
+
+		end := blockEnd
+
+		for last = 0; last < len(list); last++ {
+			stmt := list[last]
+			end = statementBoundary(stmt)
+
+			if endsBasicSourceBlock(stmt) {
+				// A label may be a target of goto, so it starts a new basic block,
+				// unless the labeled statement is a control statement.
+				if label, isLabel := stmt.(*ast.LabeledStmt); isLabel && !isControl(label.Stmt) {
+					newLabel := *label
+					newLabel.Stmt = &ast.EmptyStmt{
+						Semicolon: label.Stmt.Pos(),
+						Implicit:  true,
+					}
+					end = label.Pos() // Previous block ends before the label.
+					list[last] = &newLabel
+					// Open a gap and drop in the old statement, now without a label.
+					list = append(list, nil)
+					copy(list[last+1:], list[last:])
+					list[last+1] = label.Stmt
+				}
+
+				last++
+				extendToClosingBrace = false // Block is broken up now.
+
+				break
+			}
+		}
+
+		if extendToClosingBrace {
+			end = blockEnd
+		}
+
+		if pos != end { // Can have no source to cover if e.g. blocks abut.
+			v.addBlock(pos, end, last)
+		}
+
+		list = list[last:]
+		if len(list) == 0 {
+			break
+		}
+
+		pos = list[0].Pos()
+	}
+}
+
+func (v *BlockVisitor) addBlock(start, end token.Pos, numStmt int) {
+	// Physical positions, ignoring //line directives.
+	s := v.fset.PositionFor(start, false)
+	e := v.fset.PositionFor(end, false)
+
+	v.blocks = append(v.blocks, profileBlock{
+		StartLine: s.Line,
+		StartCol:  s.Column,
+		EndLine:   e.Line,
+		EndCol:    e.Column,
+		NumStmt:   numStmt,
+	})
+}
+
+// findText finds text in the source starting at pos, skipping comments.
+// It returns a byte offset within the source or -1.
+func (v *BlockVisitor) findText(pos token.Pos, text string) int {
+	b := []byte(text)
+	i := v.fset.PositionFor(pos, false).Offset
+	s := v.content
+
+	for i < len(s) {
+		if bytes.HasPrefix(s[i:], b) {
+			return i
+		}
+
+		if i+2 <= len(s) && s[i] == '/' && s[i+1] == '/' {
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+
+			continue
+		}
+
+		if i+2 <= len(s) && s[i] == '/' && s[i+1] == '*' {
+			for i += 2; ; i++ {
+				if i+2 > len(s) {
+					return -1
+				}
+
+				if s[i] == '*' && s[i+1] == '/' {
+					i += 2
+
+					break
+				}
+			}
+
+			continue
+		}
+
+		i++
+	}
+
+	return -1
+}
+
+// statementBoundary finds the location in s that terminates the current basic block in the source.
+func statementBoundary(s ast.Stmt) token.Pos {
+	// Control flow statements are easy.
+	switch s := s.(type) {
+	case *ast.BlockStmt:
+		// Treat blocks like basic blocks to avoid overlapping counters.
+		return s.Lbrace
+	case *ast.IfStmt:
+		if found, pos := hasFuncLiteral(s.Init); found {
+			return pos
+		}
+
+		if found, pos := hasFuncLiteral(s.Cond); found {
+			return pos
+		}
+
+		return s.Body.Lbrace
+	case *ast.ForStmt:
+		if found, pos := hasFuncLiteral(s.Init); found {
+			return pos
+		}
+
+		if found, pos := hasFuncLiteral(s.Cond); found {
+			return pos
+		}
+
+		if found, pos := hasFuncLiteral(s.Post); found {
+			return pos
+		}
+
+		return s.Body.Lbrace
+	case *ast.LabeledStmt:
+		return statementBoundary(s.Stmt)
+	case *ast.RangeStmt:
+		if found, pos := hasFuncLiteral(s.X); found {
+			return pos
+		}
+
+		return s.Body.Lbrace
+	case *ast.SwitchStmt:
+		if found, pos := hasFuncLiteral(s.Init); found {
+			return pos
+		}
+
+		if found, pos := hasFuncLiteral(s.Tag); found {
+			return pos
+		}
+
+		return s.Body.Lbrace
+	case *ast.SelectStmt:
+		return s.Body.Lbrace
+	case *ast.TypeSwitchStmt:
+		if found, pos := hasFuncLiteral(s.Init); found {
+			return pos
+		}
+
+		return s.Body.Lbrace
+	}
+
+	// Body of a function literal is excluded from the block of the statement.
+	if found, pos := hasFuncLiteral(s); found {
+		return pos
+	}
+
+	return s.End()
+}
+
+// endsBasicSourceBlock reports whether s changes the flow of control: break, if, etc.,
+// or contains a function literal.
+func endsBasicSourceBlock(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.BlockStmt, *ast.BranchStmt, *ast.ForStmt, *ast.IfStmt, *ast.LabeledStmt,
+		*ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt:
+		return true
+	case *ast.ExprStmt:
+		// Calls to panic change the flow.
+		if call, ok := s.X.(*ast.CallExpr); ok {
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == "panic" && len(call.Args) == 1 {
+				return true
+			}
+		}
+	}
+
+	found, _ := hasFuncLiteral(s)
+
+	return found
+}
+
+// isControl reports whether s is a control statement that, if labeled, cannot be separated from its label.
+func isControl(s ast.Stmt) bool {
+	switch s.(type) {
+	case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.SelectStmt, *ast.TypeSwitchStmt:
+		return true
+	}
+
+	return false
+}
+
+// hasFuncLiteral reports the existence and position of the body of the first func literal in the node.
+func hasFuncLiteral(n ast.Node) (bool, token.Pos) {
+	if n == nil {
+		return false, token.NoPos
+	}
+
+	var literal funcLitFinder
+
+	ast.Walk(&literal, n)
+
+	return token.Pos(literal) != token.NoPos, token.Pos(literal)
+}
+
+// funcLitFinder implements the visitor to find the location of any function literal in a subtree.
+type funcLitFinder token.Pos
+
+func (f *funcLitFinder) Visit(node ast.Node) ast.Visitor {
+	if token.Pos(*f) != token.NoPos {
+		return nil // Prune search.
+	}
+
+	if n, ok := node.(*ast.FuncLit); ok {
+		*f = funcLitFinder(n.Body.Lbrace)
+
+		return nil // Prune search.
+	}
+
+	return f
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findBlocks(t *testing.T) {
+	var expected []profileBlock
+
+	_, err := parseProfiles("_testdata/coverage.txt", nil, func(fn string, block profileBlock) {
+		if fn == "sample/foo.go" {
+			block.Count = 0
+			expected = append(expected, block)
+		}
+	})
+	require.NoError(t, err)
+
+	blocks, err := findBlocks("_testdata/foo.go")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, blocks)
+}
+
+func Test_findBlocks_controlFlow(t *testing.T) {
+	blocks, err := findBlocks("_testdata/flow/flow.go")
+	require.NoError(t, err)
+	assert.Equal(t, []profileBlock{
+		{StartLine: 3, StartCol: 15, EndLine: 3, EndCol: 16, NumStmt: 0},
+		{StartLine: 5, StartCol: 35, EndLine: 6, EndCol: 11, NumStmt: 1},
+		{StartLine: 14, StartCol: 2, EndLine: 14, EndCol: 11, NumStmt: 1},
+		{StartLine: 20, StartCol: 2, EndLine: 20, EndCol: 9, NumStmt: 1},
+		{StartLine: 25, StartCol: 2, EndLine: 25, EndCol: 18, NumStmt: 1},
+		{StartLine: 30, StartCol: 2, EndLine: 31, EndCol: 12, NumStmt: 2},
+		{StartLine: 35, StartCol: 2, EndLine: 35, EndCol: 13, NumStmt: 1},
+		{StartLine: 39, StartCol: 2, EndLine: 39, EndCol: 10, NumStmt: 1},
+		{StartLine: 6, StartCol: 11, EndLine: 8, EndCol: 3, NumStmt: 1},
+		{StartLine: 8, StartCol: 8, EndLine: 8, EndCol: 19, NumStmt: 1},
+		{StartLine: 8, StartCol: 19, EndLine: 10, EndCol: 3, NumStmt: 1},
+		{StartLine: 10, StartCol: 8, EndLine: 12, EndCol: 3, NumStmt: 1},
+		{StartLine: 15, StartCol: 9, EndLine: 16, EndCol: 6, NumStmt: 1},
+		{StartLine: 17, StartCol: 10, EndLine: 17, EndCol: 10, NumStmt: 0},
+		{StartLine: 21, StartCol: 12, EndLine: 22, EndCol: 6, NumStmt: 1},
+		{StartLine: 25, StartCol: 18, EndLine: 27, EndCol: 3, NumStmt: 1},
+		{StartLine: 31, StartCol: 12, EndLine: 32, EndCol: 12, NumStmt: 1},
+		{StartLine: 35, StartCol: 13, EndLine: 36, EndCol: 19, NumStmt: 1},
+	}, blocks)
+}
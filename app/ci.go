@@ -0,0 +1,143 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// ciBase is a base of changes detected from CI environment.
+type ciBase struct {
+	provider string
+	ref      string // Commit or branch name.
+	head     string // Head commit if it is not checked out, empty for HEAD.
+
+	// mergeBase is true if ref is a target branch or its tip, so fork point is a merge base with head.
+	mergeBase bool
+}
+
+// ciProvider detects base of changes from environment variables of CI provider.
+type ciProvider struct {
+	name   string
+	detect func(getenv func(string) string) (ciBase, bool, error)
+}
+
+var ciProviders = []ciProvider{
+	{name: "GitHub Actions", detect: func(getenv func(string) string) (ciBase, bool, error) {
+		eventPath := getenv("GITHUB_EVENT_PATH")
+		if eventPath == "" {
+			return ciBase{}, false, nil
+		}
+
+		b, err := baseFromGitHub(getenv("GITHUB_EVENT_NAME"), eventPath)
+
+		return b, true, err
+	}},
+	{name: "GitLab CI", detect: func(getenv func(string) string) (ciBase, bool, error) {
+		if sha := getenv("CI_MERGE_REQUEST_DIFF_BASE_SHA"); sha != "" {
+			return ciBase{ref: sha}, true, nil
+		}
+
+		if sha := getenv("CI_MERGE_REQUEST_TARGET_BRANCH_SHA"); sha != "" {
+			return ciBase{ref: sha, mergeBase: true}, true, nil
+		}
+
+		if branch := getenv("CI_MERGE_REQUEST_TARGET_BRANCH_NAME"); branch != "" {
+			return ciBase{ref: branch, mergeBase: true}, true, nil
+		}
+
+		return ciBase{}, false, nil
+	}},
+	{name: "Bitbucket Pipelines", detect: func(getenv func(string) string) (ciBase, bool, error) {
+		if sha := getenv("BITBUCKET_PR_DESTINATION_COMMIT"); sha != "" {
+			return ciBase{ref: sha, mergeBase: true}, true, nil
+		}
+
+		if branch := getenv("BITBUCKET_PR_DESTINATION_BRANCH"); branch != "" {
+			return ciBase{ref: branch, mergeBase: true}, true, nil
+		}
+
+		return ciBase{}, false, nil
+	}},
+	{name: "Azure Pipelines", detect: func(getenv func(string) string) (ciBase, bool, error) {
+		if branch := getenv("SYSTEM_PULLREQUEST_TARGETBRANCH"); branch != "" {
+			return ciBase{ref: strings.TrimPrefix(branch, "refs/heads/"), mergeBase: true}, true, nil
+		}
+
+		return ciBase{}, false, nil
+	}},
+	{name: "Buildkite", detect: func(getenv func(string) string) (ciBase, bool, error) {
+		if pr := getenv("BUILDKITE_PULL_REQUEST"); pr == "" || pr == "false" {
+			return ciBase{}, false, nil
+		}
+
+		if branch := getenv("BUILDKITE_PULL_REQUEST_BASE_BRANCH"); branch != "" {
+			return ciBase{ref: branch, mergeBase: true}, true, nil
+		}
+
+		return ciBase{}, false, nil
+	}},
+}
+
+// detectCIBase returns base of changes of the first CI provider that is detected in environment.
+func detectCIBase(getenv func(string) string) (ciBase, bool, error) {
+	for _, p := range ciProviders {
+		b, ok, err := p.detect(getenv)
+		if err != nil {
+			return ciBase{}, false, fmt.Errorf("%s: %w", p.name, err)
+		}
+
+		if ok {
+			b.provider = p.name
+
+			return b, true, nil
+		}
+	}
+
+	return ciBase{}, false, nil
+}
+
+// forkPointFromCI returns fork point and head commit from CI environment, false if no CI provider is detected.
+// Head is empty if changes are checked out.
+func forkPointFromCI(getenv func(string) string) (string, string, bool, error) {
+	b, ok, err := detectCIBase(getenv)
+	if err != nil || !ok {
+		return "", "", ok, err
+	}
+
+	if !b.mergeBase {
+		log.Printf("fork point %s is detected from %s", b.ref, b.provider)
+
+		return b.ref, b.head, true, nil
+	}
+
+	ref := resolveBranch(b.ref)
+
+	head := b.head
+	if head == "" {
+		head = "HEAD"
+	}
+
+	o, err := exec.Command("git", "merge-base", ref, head).CombinedOutput()
+	if err != nil {
+		return "", "", true, fmt.Errorf("%s: git merge-base %s %s: %w\n%s", b.provider, ref, head, err, string(o))
+	}
+
+	forkPoint := strings.TrimSpace(string(o))
+
+	log.Printf("fork point %s is detected from %s as merge base of %s and %s", forkPoint, b.provider, ref, head)
+
+	return forkPoint, b.head, true, nil
+}
+
+// resolveBranch returns remote tracking branch of origin if it exists, CI checkouts often lack local branches.
+func resolveBranch(ref string) string {
+	remote := "refs/remotes/origin/" + ref
+
+	if err := exec.Command("git", "rev-parse", "--verify", "--quiet", remote).Run(); err == nil {
+		return remote
+	}
+
+	return ref
+}
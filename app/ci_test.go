@@ -0,0 +1,108 @@
+package app
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectCIBase(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		base ciBase
+		ok   bool
+	}{
+		{env: map[string]string{}},
+		{
+			env:  map[string]string{"CI_MERGE_REQUEST_DIFF_BASE_SHA": "abc", "CI_MERGE_REQUEST_TARGET_BRANCH_SHA": "def"},
+			base: ciBase{provider: "GitLab CI", ref: "abc"}, ok: true,
+		},
+		{
+			env:  map[string]string{"CI_MERGE_REQUEST_TARGET_BRANCH_NAME": "main"},
+			base: ciBase{provider: "GitLab CI", ref: "main", mergeBase: true}, ok: true,
+		},
+		{
+			env:  map[string]string{"BITBUCKET_PR_DESTINATION_COMMIT": "abc", "BITBUCKET_PR_DESTINATION_BRANCH": "main"},
+			base: ciBase{provider: "Bitbucket Pipelines", ref: "abc", mergeBase: true}, ok: true,
+		},
+		{
+			env:  map[string]string{"SYSTEM_PULLREQUEST_TARGETBRANCH": "refs/heads/develop"},
+			base: ciBase{provider: "Azure Pipelines", ref: "develop", mergeBase: true}, ok: true,
+		},
+		{
+			env: map[string]string{"BUILDKITE_PULL_REQUEST": "false", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main"},
+		},
+		{
+			env:  map[string]string{"BUILDKITE_PULL_REQUEST": "12", "BUILDKITE_PULL_REQUEST_BASE_BRANCH": "main"},
+			base: ciBase{provider: "Buildkite", ref: "main", mergeBase: true}, ok: true,
+		},
+	} {
+		env := tc.env
+		b, ok, err := detectCIBase(func(k string) string { return env[k] })
+		require.NoError(t, err)
+		assert.Equal(t, tc.ok, ok, env)
+		assert.Equal(t, tc.base, b, env)
+	}
+}
+
+func Test_forkPointFromCI(t *testing.T) {
+	o, err := exec.Command("git", "rev-parse", "HEAD").Output()
+	require.NoError(t, err)
+
+	head := strings.TrimSpace(string(o))
+
+	env := map[string]string{"BITBUCKET_PR_DESTINATION_COMMIT": "HEAD"}
+
+	fp, h, ok, err := forkPointFromCI(func(k string) string { return env[k] })
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, head, fp)
+	assert.Equal(t, "", h)
+
+	_, _, ok, err = forkPointFromCI(func(k string) string { return "" })
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func Test_baseFromGitHub(t *testing.T) {
+	for _, tc := range []struct {
+		event string
+		file  string
+		base  ciBase
+		err   string
+	}{
+		{event: "pull_request", base: ciBase{ref: "1111111111111111111111111111111111111111"}},
+		{event: "", file: "pull_request", base: ciBase{ref: "1111111111111111111111111111111111111111"}},
+		{event: "pull_request_target", base: ciBase{
+			ref:  "1111111111111111111111111111111111111111",
+			head: "2222222222222222222222222222222222222222", mergeBase: true,
+		}},
+		{event: "push", base: ciBase{ref: "3333333333333333333333333333333333333333"}},
+		{event: "push", file: "push_new_branch", base: ciBase{ref: "master", mergeBase: true}},
+		{event: "merge_group", base: ciBase{ref: "6666666666666666666666666666666666666666"}},
+		{event: "workflow_run", base: ciBase{
+			ref:  "1111111111111111111111111111111111111111",
+			head: "2222222222222222222222222222222222222222", mergeBase: true,
+		}},
+		{event: "issues", err: `unsupported GitHub event "issues", set -base or -parent`},
+	} {
+		file := tc.file
+		if file == "" {
+			file = tc.event
+		}
+
+		b, err := baseFromGitHub(tc.event, "_testdata/github/"+file+".json")
+
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+
+			continue
+		}
+
+		require.NoError(t, err, file)
+		assert.Equal(t, tc.base, b, file)
+	}
+}
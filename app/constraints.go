@@ -0,0 +1,39 @@
+package app
+
+import (
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"strings"
+)
+
+// buildContext returns build context of test run configuration.
+func buildContext(goos, goarch, tags string) build.Context {
+	ctx := build.Default
+
+	if goos != "" {
+		ctx.GOOS = goos
+	}
+
+	if goarch != "" {
+		ctx.GOARCH = goarch
+	}
+
+	for _, t := range strings.Split(tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			ctx.BuildTags = append(ctx.BuildTags, t)
+		}
+	}
+
+	return ctx
+}
+
+// isBuilt checks if file name and build constraints of a file match build context.
+func isBuilt(ctx build.Context, fileName string) (bool, error) {
+	ok, err := ctx.MatchFile(filepath.Dir(fileName), filepath.Base(fileName))
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate build constraints: %w", err)
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,406 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// This file implements a decoder of binary coverage data directories (GOCOVERDIR)
+// produced by "go build -cover" binaries and "go test -test.gocoverdir" since Go 1.20.
+// See https://github.com/golang/go/blob/go1.22.0/src/internal/coverage/defs.go for format description.
+
+const (
+	covMetaPrefix     = "covmeta."
+	covCountersPrefix = "covcounters."
+
+	covMetaFileHeaderSize    = 56
+	covMetaSymbolHeaderSize  = 44
+	covCounterFileHeaderSize = 32
+	covCounterFileFooterSize = 16
+)
+
+var (
+	covMetaMagic    = []byte{0x00, 0x63, 0x76, 0x6d}
+	covCounterMagic = []byte{0x00, 0x63, 0x77, 0x6d}
+
+	errCovDataCorrupted = errors.New("corrupted coverage data")
+)
+
+// covFunc identifies a function in coverage meta-data file.
+type covFunc struct {
+	pkgIdx, funcIdx uint32
+}
+
+// isCoverDir checks if the path is a directory with binary coverage data.
+func isCoverDir(path string) bool {
+	fi, err := os.Stat(path)
+
+	return err == nil && fi.IsDir()
+}
+
+// parseCoverDir decodes binary coverage data in the specified directory and
+// calls a function for each coverable unit described therein, the result is
+// equivalent to "go tool covdata textfmt" output.
+// It returns the mode of the coverage data.
+func parseCoverDir(dir string, cb func(fn string, block profileBlock)) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	var metaFiles []string
+
+	counterFiles := map[string][]string{}
+
+	for _, e := range entries {
+		name := e.Name()
+
+		switch {
+		case strings.HasPrefix(name, covMetaPrefix):
+			metaFiles = append(metaFiles, name)
+		case strings.HasPrefix(name, covCountersPrefix):
+			hash := strings.Split(strings.TrimPrefix(name, covCountersPrefix), ".")[0]
+			counterFiles[hash] = append(counterFiles[hash], name)
+		}
+	}
+
+	if len(metaFiles) == 0 {
+		return "", fmt.Errorf("no coverage meta-data files found in %s", dir)
+	}
+
+	sort.Strings(metaFiles)
+
+	mode := ""
+
+	for _, name := range metaFiles {
+		hash := strings.TrimPrefix(name, covMetaPrefix)
+		counters := map[covFunc][]uint32{}
+
+		for _, cn := range counterFiles[hash] {
+			if err := readCovCounters(filepath.Join(dir, cn), counters); err != nil {
+				return "", fmt.Errorf("%s: %w", cn, err)
+			}
+		}
+
+		m, err := readCovMeta(filepath.Join(dir, name), counters, cb)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+
+		if mode == "" {
+			mode = m
+		} else if mode != m {
+			return "", fmt.Errorf("%s: mode %q does not match mode %q of other meta-data files", name, m, mode)
+		}
+	}
+
+	return mode, nil
+}
+
+// readCovMeta decodes coverage meta-data file and calls a function for each coverable unit.
+func readCovMeta(fileName string, counters map[covFunc][]uint32, cb func(fn string, block profileBlock)) (string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	r := covReader{b: data}
+
+	if !bytes.Equal(r.readBytes(4), covMetaMagic) {
+		return "", errors.New("invalid magic string: not a meta-data file")
+	}
+
+	if v := r.readUint32(); v > 1 {
+		return "", fmt.Errorf("unsupported meta-data file version %d", v)
+	}
+
+	r.readUint64() // Total length.
+	numPkgs := r.readUint64()
+	r.seek(covMetaFileHeaderSize - 8)
+
+	mode := ""
+
+	switch r.readUint8() {
+	case 1:
+		mode = "set"
+	case 2:
+		mode = "count"
+	case 3:
+		mode = "atomic"
+	default:
+		return "", errors.New("unsupported counter mode")
+	}
+
+	if r.err != nil || numPkgs > uint64(len(data)) {
+		return "", errCovDataCorrupted
+	}
+
+	offsets := make([]uint64, numPkgs)
+	lengths := make([]uint64, numPkgs)
+
+	r.seek(covMetaFileHeaderSize)
+
+	for i := range offsets {
+		offsets[i] = r.readUint64()
+	}
+
+	for i := range lengths {
+		lengths[i] = r.readUint64()
+	}
+
+	if r.err != nil {
+		return "", r.err
+	}
+
+	for i := range offsets {
+		if offsets[i]+lengths[i] > uint64(len(data)) {
+			return "", errCovDataCorrupted
+		}
+
+		pkg := covReader{b: data[offsets[i] : offsets[i]+lengths[i]]}
+		if err := pkg.visitPackage(uint32(i), counters, cb); err != nil {
+			return "", err
+		}
+	}
+
+	return mode, nil
+}
+
+// visitPackage decodes package meta-data payload and calls a function for each coverable unit.
+func (r *covReader) visitPackage(pkgIdx uint32, counters map[covFunc][]uint32, cb func(fn string, block profileBlock)) error {
+	r.seek(covMetaSymbolHeaderSize - 4)
+	numFuncs := r.readUint32()
+
+	if r.err != nil || numFuncs > uint32(len(r.b)) {
+		return errCovDataCorrupted
+	}
+
+	r.seek(covMetaSymbolHeaderSize + 4*int(numFuncs))
+	strtab := r.readStringTable()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	for fi := uint32(0); fi < numFuncs; fi++ {
+		r.seek(covMetaSymbolHeaderSize + 4*int(fi))
+		r.seek(int(r.readUint32()))
+
+		numUnits := r.readULEB128()
+		r.readULEB128() // Function name.
+		fileIdx := r.readULEB128()
+
+		if r.err != nil || fileIdx >= uint64(len(strtab)) || numUnits > uint64(len(r.b)) {
+			return errCovDataCorrupted
+		}
+
+		fn := strtab[fileIdx]
+		cnt := counters[covFunc{pkgIdx: pkgIdx, funcIdx: fi}]
+
+		for k := 0; k < int(numUnits); k++ {
+			block := profileBlock{
+				StartLine: int(r.readULEB128()),
+				StartCol:  int(r.readULEB128()),
+				EndLine:   int(r.readULEB128()),
+				EndCol:    int(r.readULEB128()),
+				NumStmt:   int(r.readULEB128()),
+			}
+
+			if k < len(cnt) {
+				block.Count = int(cnt[k])
+			}
+
+			if r.err != nil {
+				return r.err
+			}
+
+			cb(fn, block)
+		}
+	}
+
+	return nil
+}
+
+// readCovCounters decodes coverage counter data file and adds counters to the map.
+func readCovCounters(fileName string, counters map[covFunc][]uint32) error {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	r := covReader{b: data}
+
+	if !bytes.Equal(r.readBytes(4), covCounterMagic) {
+		return errors.New("invalid magic string: not a counter data file")
+	}
+
+	if v := r.readUint32(); v > 1 {
+		return fmt.Errorf("unsupported counter data file version %d", v)
+	}
+
+	r.readBytes(16) // Meta-data hash.
+
+	flavor := r.readUint8()
+	bigEndian := r.readUint8() != 0
+
+	r.seek(len(data) - covCounterFileFooterSize)
+
+	if !bytes.Equal(r.readBytes(4), covCounterMagic) {
+		return errors.New("invalid magic string in footer: not a counter data file")
+	}
+
+	r.readBytes(4) // Padding.
+	numSegments := r.readUint32()
+
+	var readCounter func() uint32
+
+	switch {
+	case flavor == 2:
+		readCounter = func() uint32 { return uint32(r.readULEB128()) }
+	case flavor == 1 && bigEndian:
+		readCounter = func() uint32 { return binary.BigEndian.Uint32(r.readBytes(4)) }
+	case flavor == 1:
+		readCounter = r.readUint32
+	default:
+		return fmt.Errorf("unsupported counter flavor %d", flavor)
+	}
+
+	r.seek(covCounterFileHeaderSize)
+
+	for s := uint32(0); s < numSegments; s++ {
+		if s > 0 {
+			r.readBytes(covCounterFileFooterSize)
+		}
+
+		numFuncs := r.readUint64()
+		strTabLen := r.readUint32()
+		argsLen := r.readUint32()
+
+		r.readBytes(int(strTabLen))
+		r.readBytes(int(argsLen))
+
+		if rem := r.off % 4; rem != 0 {
+			r.readBytes(4 - rem)
+		}
+
+		if r.err != nil || numFuncs > uint64(len(data)) {
+			return errCovDataCorrupted
+		}
+
+		for i := uint64(0); i < numFuncs; i++ {
+			nc := readCounter()
+			k := covFunc{pkgIdx: readCounter(), funcIdx: readCounter()}
+
+			if r.err != nil || nc > uint32(len(data)) {
+				return errCovDataCorrupted
+			}
+
+			cnt := counters[k]
+			for len(cnt) < int(nc) {
+				cnt = append(cnt, 0)
+			}
+
+			for j := uint32(0); j < nc; j++ {
+				cnt[j] += readCounter()
+			}
+
+			counters[k] = cnt
+		}
+	}
+
+	return r.err
+}
+
+// covReader reads little-endian binary data from a byte slice,
+// out of bounds reads are reported with err.
+type covReader struct {
+	b   []byte
+	off int
+	err error
+}
+
+func (r *covReader) seek(off int) {
+	if off < 0 || off > len(r.b) {
+		r.err = errCovDataCorrupted
+
+		return
+	}
+
+	r.off = off
+}
+
+func (r *covReader) readBytes(n int) []byte {
+	if r.err != nil || n < 0 || r.off+n > len(r.b) {
+		r.err = errCovDataCorrupted
+
+		return make([]byte, n)
+	}
+
+	b := r.b[r.off : r.off+n]
+	r.off += n
+
+	return b
+}
+
+func (r *covReader) readUint8() uint8 {
+	return r.readBytes(1)[0]
+}
+
+func (r *covReader) readUint32() uint32 {
+	return binary.LittleEndian.Uint32(r.readBytes(4))
+}
+
+func (r *covReader) readUint64() uint64 {
+	return binary.LittleEndian.Uint64(r.readBytes(8))
+}
+
+func (r *covReader) readULEB128() uint64 {
+	var (
+		v     uint64
+		shift uint
+	)
+
+	for r.err == nil {
+		b := r.readUint8()
+		v |= uint64(b&0x7f) << shift
+
+		if b&0x80 == 0 {
+			break
+		}
+
+		shift += 7
+	}
+
+	return v
+}
+
+// readStringTable reads a table of strings prefixed with their lengths.
+func (r *covReader) readStringTable() []string {
+	n := r.readULEB128()
+	if n > uint64(len(r.b)) {
+		r.err = errCovDataCorrupted
+
+		return nil
+	}
+
+	strs := make([]string, 0, n)
+
+	for i := uint64(0); i < n && r.err == nil; i++ {
+		l := r.readULEB128()
+		if l > uint64(len(r.b)) {
+			r.err = errCovDataCorrupted
+
+			break
+		}
+
+		strs = append(strs, string(r.readBytes(int(l))))
+	}
+
+	return strs
+}
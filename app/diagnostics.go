@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// pathDiagnostics explains why changed files are missing from coverage profile.
+type pathDiagnostics struct {
+	mapper   *pathMapper
+	rawFiles []string
+	byBase   map[string][]string
+}
+
+func newPathDiagnostics(mapper *pathMapper, rawFiles []string) *pathDiagnostics {
+	d := &pathDiagnostics{
+		mapper:   mapper,
+		rawFiles: rawFiles,
+		byBase:   map[string][]string{},
+	}
+
+	for _, fn := range rawFiles {
+		d.byBase[path.Base(fn)] = append(d.byBase[path.Base(fn)], fn)
+	}
+
+	return d
+}
+
+// diagnose returns a description of likely path mismatch for a changed file that is not in the profile,
+// empty result means the file is likely not tested.
+// Profile files that are mapped to other existing files are not considered.
+func (d *pathDiagnostics) diagnose(fn string) string {
+	fs := strings.Split(fn, "/")
+	minSuffix := 2
+
+	if len(fs) < minSuffix {
+		minSuffix = len(fs)
+	}
+
+	var (
+		bestRaw    string
+		bestSuffix int
+	)
+
+	for _, raw := range d.byBase[path.Base(fn)] {
+		// Profile file that maps to another existing file of repository is not a mismatch.
+		if mapped := d.mapper.repoPath(raw); mapped != fn {
+			if _, err := os.Stat(d.mapper.filePath(mapped)); err == nil {
+				continue
+			}
+		}
+
+		n := commonSuffix(strings.Split(raw, "/"), fs)
+
+		if n > bestSuffix || (n == bestSuffix && raw < bestRaw) {
+			bestRaw, bestSuffix = raw, n
+		}
+	}
+
+	if bestSuffix >= minSuffix {
+		rs := strings.Split(bestRaw, "/")
+		from := strings.Join(rs[:len(rs)-bestSuffix], "/")
+		to := strings.Join(fs[:len(fs)-bestSuffix], "/")
+
+		var hint string
+
+		switch {
+		case from == "":
+			hint = fmt.Sprintf("try -path-rewrite 're:^=>%s/'", to)
+		case to == "" && !path.IsAbs(from):
+			hint = fmt.Sprintf("try -mod %s or -path-rewrite '%s/=>'", from, from)
+		case to == "":
+			hint = fmt.Sprintf("try -path-rewrite '%s/=>'", from)
+		default:
+			hint = fmt.Sprintf("try -path-rewrite '%s/=>%s/'", from, to)
+		}
+
+		if mapped := d.mapper.repoPath(bestRaw); mapped != bestRaw {
+			return fmt.Sprintf("profile has %s (mapped to %s), %s", bestRaw, mapped, hint)
+		}
+
+		return fmt.Sprintf("profile has %s, %s", bestRaw, hint)
+	}
+
+	if mod := d.mapper.moduleOf(fn); mod != "" {
+		for _, raw := range d.rawFiles {
+			if strings.HasPrefix(raw, mod+"/") {
+				return ""
+			}
+		}
+
+		return fmt.Sprintf("profile has no entries of module %s, check -cov and -mod", mod)
+	}
+
+	return ""
+}
+
+// commonSuffix returns the number of common trailing path segments.
+func commonSuffix(a, b []string) int {
+	n := 0
+
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+
+	return n
+}
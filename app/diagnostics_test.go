@@ -0,0 +1,29 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_pathDiagnostics_diagnose(t *testing.T) {
+	tmp := t.TempDir()
+
+	for _, fn := range []string{"pkg/util/util.go", "internal/util/util.go"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmp, filepath.Dir(fn)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, fn), []byte("package util\n"), 0o600))
+	}
+
+	m := &pathMapper{root: tmp}
+
+	// Profile file of another existing file is not a mismatch.
+	d := newPathDiagnostics(m, []string{"pkg/util/util.go"})
+	assert.Empty(t, d.diagnose("internal/util/util.go"))
+
+	d = newPathDiagnostics(m, []string{"pkg/util/util.go", "/build/internal/util/util.go"})
+	assert.Equal(t, "profile has /build/internal/util/util.go, try -path-rewrite '/build/=>'",
+		d.diagnose("internal/util/util.go"))
+}
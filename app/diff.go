@@ -1,58 +1,259 @@
 package app
 
 import (
+	"bytes"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
 
-	"github.com/waigani/diffparser"
+// Modes of git diff.
+const (
+	diffWorktree  = "worktree"  // Committed, staged and unstaged changes.
+	diffStaged    = "staged"    // Staged changes only.
+	diffCommitted = "committed" // Committed changes only.
 )
 
-func gitDiff(forkPoint string) ([]byte, error) {
-	var err error
+// forkPoint returns fork point and head commit of changes, head is empty if changes are checked out.
+func forkPoint(strategies []string) (string, string, error) {
+	forkPoint, head, ok, err := forkPointFromCI(os.Getenv)
+	if !ok && err == nil {
+		forkPoint, err = forkPointFromLocal(strategies)
+	}
 
-	if forkPoint == "" {
-		if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
-			forkPoint, err = forkPointFromGitHub(eventPath)
-		} else {
-			forkPoint, err = forkPointFromLocal()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to file fork point: %w", err)
+	}
+
+	return forkPoint, head, nil
+}
+
+// gitDiffArgs returns arguments of git diff for base and head commits and diff mode.
+func gitDiffArgs(f flags) ([]string, error) {
+	base := f.base
+	if base == "" {
+		base = f.parentCommit
+	}
+
+	head := f.head
+	mode := f.diffMode
+
+	switch {
+	case base != "":
+	case mode == diffStaged:
+		// Staged changes are compared to HEAD to check what is about to be committed.
+		base = "HEAD"
+	default:
+		fp, h, err := forkPoint(strings.Split(f.forkStrategy, ","))
+		if err != nil {
+			return nil, err
+		}
+
+		base = fp
+
+		if head == "" {
+			head = h
+		}
+	}
+
+	if head != "" {
+		mode = diffCommitted
+	}
+
+	if mode == diffCommitted && head == "" {
+		head = "HEAD"
+	}
+
+	if f.threeDot {
+		h := head
+		if h == "" {
+			h = "HEAD"
 		}
 
+		o, err := exec.Command("git", "merge-base", base, h).CombinedOutput()
 		if err != nil {
-			return nil, fmt.Errorf("failed to file fork point: %w", err)
+			return nil, fmt.Errorf("git merge-base %s %s: %w\n%s", base, h, err, string(o))
 		}
+
+		base = strings.TrimSpace(string(o))
 	}
 
-	o, err := exec.Command("git", "diff", forkPoint, "--no-color").CombinedOutput()
+	// Submodule format is explicit to get pointer changes regardless of diff.submodule config.
+	args := []string{"diff", "--no-color", "--submodule=short"}
+
+	if mode == diffStaged {
+		args = append(args, "--cached")
+	}
+
+	args = append(args, base)
+
+	if head != "" {
+		args = append(args, head)
+	}
+
+	return args, nil
+}
+
+func gitDiff(f flags) ([]byte, error) {
+	args, err := gitDiffArgs(f)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := exec.Command("git", args...).CombinedOutput()
 	if err != nil {
-		return nil, fmt.Errorf("git diff %s --no-color: %w\n%s", forkPoint, err, string(o))
+		return nil, fmt.Errorf("git %s: %w\n%s", strings.Join(args, " "), err, string(o))
 	}
 
 	return o, nil
 }
 
-func getDiff(diffFile string, parentCommit string) (*diffparser.Diff, error) {
-	var d []byte
+// untrackedFiles returns diffs of untracked .go files as fully added.
+func untrackedFiles(root string) ([]*fileDiff, error) {
+	o, err := exec.Command("git", "-C", root, "ls-files", "--others", "--exclude-standard", "--full-name", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files --others: %w", err)
+	}
+
+	var files []*fileDiff
+
+	for _, name := range strings.Split(string(o), "\x00") {
+		if !strings.HasSuffix(name, ".go") {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read untracked file: %w", err)
+		}
+
+		files = append(files, addedFile(name, content))
+	}
+
+	return files, nil
+}
+
+// addedFile returns diff of a new file with all lines added.
+func addedFile(name string, content []byte) *fileDiff {
+	f := &fileDiff{newName: name, status: fileAdded}
+
+	if len(content) == 0 {
+		return f
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	h := &diffHunk{newStart: 1, newLines: len(lines)}
+
+	for i, l := range lines {
+		h.lines = append(h.lines, diffLine{kind: lineAdded, newNum: i + 1, content: l})
+	}
+
+	h.lines[len(lines)-1].noNewline = !bytes.HasSuffix(content, []byte("\n"))
+	f.hunks = append(f.hunks, h)
+
+	return f
+}
+
+// mboxFromLine starts a patch in mbox, as produced by git format-patch.
+var mboxFromLine = regexp.MustCompile(`(?m)^From [0-9a-f]{40} `)
+
+// splitMbox splits mbox into patches, data without mbox headers is returned as a single patch.
+func splitMbox(data []byte) [][]byte {
+	idx := mboxFromLine.FindAllIndex(data, -1)
+	if len(idx) < 2 {
+		return [][]byte{data}
+	}
+
+	patches := make([][]byte, 0, len(idx))
+
+	for i, loc := range idx {
+		end := len(data)
+		if i+1 < len(idx) {
+			end = idx[i+1][0]
+		}
+
+		patches = append(patches, data[loc[0]:end])
+	}
+
+	return patches
+}
 
-	if diffFile == "" {
-		o, err := gitDiff(parentCommit)
+// readDiffs reads patches from diff files, or from git diff if no files are provided.
+func readDiffs(f flags) ([][]byte, error) {
+	if len(f.diffFiles) == 0 {
+		o, err := gitDiff(f)
 		if err != nil {
 			return nil, err
 		}
 
-		d = o
-	} else {
-		df, err := os.ReadFile(diffFile)
+		return [][]byte{o}, nil
+	}
+
+	var patches [][]byte
+
+	for _, fn := range f.diffFiles {
+		var (
+			d   []byte
+			err error
+		)
+
+		if fn == "-" {
+			d, err = io.ReadAll(os.Stdin)
+		} else {
+			d, err = os.ReadFile(fn)
+		}
+
 		if err != nil {
-			log.Fatal(err)
+			return nil, fmt.Errorf("failed to read diff %s: %w", fn, err)
 		}
-		d = df
+
+		patches = append(patches, splitMbox(d)...)
 	}
 
-	diff, err := diffparser.Parse(string(d))
+	return patches, nil
+}
+
+// getDiff returns changes of git diff or diff files, patches of multiple files and mbox are applied in order.
+func getDiff(f flags) (*unifiedDiff, error) {
+	patches, err := readDiffs(f)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse git diff: %w", err)
+		return nil, err
+	}
+
+	diffs := make([]*unifiedDiff, 0, len(patches))
+
+	for i, p := range patches {
+		d, err := parseDiff(bytes.NewReader(p))
+		if err != nil {
+			if len(patches) > 1 {
+				return nil, fmt.Errorf("failed to parse patch %d: %w", i+1, err)
+			}
+
+			return nil, fmt.Errorf("failed to parse git diff: %w", err)
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	diff := combineDiffs(diffs)
+
+	if f.submodules {
+		if err := expandSubmodules(diff, f.root); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.untracked {
+		files, err := untrackedFiles(f.root)
+		if err != nil {
+			return nil, err
+		}
+
+		diff.files = append(diff.files, files...)
 	}
 
 	return diff, nil
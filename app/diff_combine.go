@@ -0,0 +1,372 @@
+package app
+
+import (
+	"sort"
+)
+
+// combinedFile is a state of file changed by a series of patches.
+type combinedFile struct {
+	origName string // Name before the first patch, empty if file is created.
+	name     string // Current name, empty if file is deleted.
+	oldMode  string
+	newMode  string
+	binary   bool
+	copied   bool
+
+	added   map[int]string     // Contents of added lines by current line number.
+	removed map[int][]diffLine // Removed lines with line numbers of the first version by current line number that follows them.
+}
+
+// combineDiffs combines diffs of consecutive patches into changes of the last version against the first.
+// Combined hunks only have added and removed lines without context.
+func combineDiffs(diffs []*unifiedDiff) *unifiedDiff {
+	if len(diffs) == 1 {
+		return diffs[0]
+	}
+
+	var (
+		files   []*combinedFile
+		current = map[string]*combinedFile{}
+	)
+
+	for _, d := range diffs {
+		for _, fd := range d.files {
+			cf := current[fd.oldName]
+
+			// Copy leaves the source file in place.
+			if cf == nil || fd.oldName == "" || fd.status == fileCopied {
+				cf = &combinedFile{
+					origName: fd.oldName,
+					oldMode:  fd.oldMode,
+					copied:   fd.status == fileCopied,
+					added:    map[int]string{},
+					removed:  map[int][]diffLine{},
+				}
+				files = append(files, cf)
+			} else {
+				delete(current, fd.oldName)
+			}
+
+			cf.apply(fd)
+
+			if cf.name != "" {
+				current[cf.name] = cf
+			}
+		}
+	}
+
+	res := &unifiedDiff{}
+
+	for _, cf := range files {
+		if cf.origName == "" && cf.name == "" {
+			continue // Created and deleted within the series.
+		}
+
+		res.files = append(res.files, cf.fileDiff())
+	}
+
+	return res
+}
+
+// apply maps changed lines through the patch of a file and adds changes of the patch.
+func (cf *combinedFile) apply(fd *fileDiff) {
+	cf.name = fd.newName
+	cf.binary = cf.binary || fd.binary
+
+	if fd.newMode != "" {
+		cf.newMode = fd.newMode
+	}
+
+	if cf.name == "" {
+		cf.added = map[int]string{}
+		cf.removed = map[int][]diffLine{}
+
+		return
+	}
+
+	added := map[int]string{}
+	removed := map[int][]diffLine{}
+
+	for n, content := range cf.added {
+		if m, ok := mapOldLine(fd.hunks, n); ok {
+			added[m] = content
+		}
+	}
+
+	for n, lines := range cf.removed {
+		m := mapOldGap(fd.hunks, n)
+		removed[m] = append(removed[m], lines...)
+	}
+
+	for _, h := range fd.hunks {
+		var pending []diffLine
+
+		for _, l := range h.lines {
+			switch l.kind {
+			case lineRemoved:
+				// Lines added by previous patches do not exist in the first version.
+				if _, ok := cf.added[l.oldNum]; !ok {
+					pending = append(pending, diffLine{kind: lineRemoved, oldNum: cf.firstLine(l.oldNum), content: l.content})
+				}
+
+				continue
+			case lineAdded:
+				added[l.newNum] = l.content
+			}
+
+			if len(pending) > 0 {
+				removed[l.newNum] = append(removed[l.newNum], pending...)
+				pending = nil
+			}
+		}
+
+		if len(pending) > 0 {
+			removed[h.nextLine()] = append(removed[h.nextLine()], pending...)
+		}
+	}
+
+	// Lines removed by different patches before the same line are ordered as in the first version.
+	for _, lines := range removed {
+		sort.Slice(lines, func(i, j int) bool {
+			return lines[i].oldNum < lines[j].oldNum
+		})
+	}
+
+	cf.added = added
+	cf.removed = removed
+}
+
+// firstLine returns line number in the first version for a current line that is not added,
+// or for a position of current line if it is added.
+func (cf *combinedFile) firstLine(n int) int {
+	res := n
+
+	for m := range cf.added {
+		if m < n {
+			res--
+		}
+	}
+
+	for m, lines := range cf.removed {
+		if m <= n {
+			res += len(lines)
+		}
+	}
+
+	return res
+}
+
+// mapOldLine returns line number in new file for a line of old file, false if line is removed.
+func mapOldLine(hunks []*diffHunk, n int) (int, bool) {
+	delta := 0
+
+	for _, h := range hunks {
+		before := h.oldStart+h.oldLines-1 < n
+		if h.oldLines == 0 {
+			before = h.oldStart < n
+		}
+
+		if before {
+			delta += h.newLines - h.oldLines
+
+			continue
+		}
+
+		if n < h.oldStart {
+			break
+		}
+
+		for _, l := range h.lines {
+			if l.oldNum != n {
+				continue
+			}
+
+			if l.kind == lineRemoved {
+				return 0, false
+			}
+
+			return l.newNum, true
+		}
+	}
+
+	return n + delta, true
+}
+
+// mapOldGap returns line number in new file that follows a position before line of old file.
+// Position before a removed line follows lines removed with it, so it is before lines added in their place.
+func mapOldGap(hunks []*diffHunk, n int) int {
+	for _, h := range hunks {
+		for i, l := range h.lines {
+			if l.kind != lineRemoved || l.oldNum != n {
+				continue
+			}
+
+			for _, next := range h.lines[i+1:] {
+				if next.kind != lineRemoved {
+					return next.newNum
+				}
+			}
+
+			return h.nextLine()
+		}
+	}
+
+	m, _ := mapOldLine(hunks, n)
+
+	return m
+}
+
+// nextLine returns line number in new file that follows the hunk.
+func (h *diffHunk) nextLine() int {
+	if h.newLines == 0 {
+		return h.newStart + 1
+	}
+
+	return h.newStart + h.newLines
+}
+
+// fileDiff returns combined changes of file.
+func (cf *combinedFile) fileDiff() *fileDiff {
+	fd := &fileDiff{
+		oldName: cf.origName,
+		newName: cf.name,
+		oldMode: cf.oldMode,
+		newMode: cf.newMode,
+		binary:  cf.binary,
+		status:  fileModified,
+	}
+
+	switch {
+	case cf.origName == "":
+		fd.status = fileAdded
+	case cf.name == "":
+		fd.status = fileDeleted
+	case cf.copied:
+		fd.status = fileCopied
+	case cf.origName != cf.name:
+		fd.status = fileRenamed
+	}
+
+	lines := make([]int, 0, len(cf.added)+len(cf.removed))
+
+	for n := range cf.added {
+		lines = append(lines, n)
+	}
+
+	for n := range cf.removed {
+		if _, ok := cf.added[n]; !ok {
+			lines = append(lines, n)
+		}
+	}
+
+	sort.Ints(lines)
+
+	// Consecutive added lines with removed lines before them form regions, old and new lines of a region
+	// are compared to drop lines that are removed and added back by the series.
+	var (
+		oldLines, newLines []diffLine
+		start              int // First line of region.
+	)
+
+	for i, n := range lines {
+		if len(oldLines) == 0 && len(newLines) == 0 {
+			start = n
+		}
+
+		oldLines = append(oldLines, cf.removed[n]...)
+
+		content, ok := cf.added[n]
+		if ok {
+			newLines = append(newLines, diffLine{kind: lineAdded, newNum: n, content: content})
+
+			if i+1 < len(lines) && lines[i+1] == n+1 {
+				continue
+			}
+		}
+
+		fd.hunks = append(fd.hunks, regionHunks(oldLines, newLines, cf.firstLine(start)+len(oldLines), start+len(newLines))...)
+		oldLines, newLines = nil, nil
+	}
+
+	return fd
+}
+
+// regionHunks returns hunks of a region of changed lines, lines that are equal in old and new lines are dropped.
+// Next old and new line numbers after region are used for empty ranges.
+func regionHunks(oldLines, newLines []diffLine, nextOld, nextNew int) []*diffHunk {
+	// lcs[i][j] is a length of common subsequence of oldLines[i:] and newLines[j:].
+	lcs := make([][]int, len(oldLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newLines)+1)
+	}
+
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			switch {
+			case oldLines[i].content == newLines[j].content:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		hunks []*diffHunk
+		h     *diffHunk
+	)
+
+	lineNums := func(i, j int) (int, int) {
+		o, n := nextOld, nextNew
+		if i < len(oldLines) {
+			o = oldLines[i].oldNum
+		}
+
+		if j < len(newLines) {
+			n = newLines[j].newNum
+		}
+
+		return o, n
+	}
+
+	for i, j := 0, 0; i < len(oldLines) || j < len(newLines); {
+		if i < len(oldLines) && j < len(newLines) && oldLines[i].content == newLines[j].content {
+			i++
+			j++
+			h = nil
+
+			continue
+		}
+
+		if h == nil {
+			h = &diffHunk{}
+			h.oldStart, h.newStart = lineNums(i, j)
+			hunks = append(hunks, h)
+		}
+
+		if j == len(newLines) || (i < len(oldLines) && lcs[i+1][j] >= lcs[i][j+1]) {
+			h.lines = append(h.lines, oldLines[i])
+			h.oldLines++
+			i++
+		} else {
+			h.lines = append(h.lines, newLines[j])
+			h.newLines++
+			j++
+		}
+	}
+
+	// Start of empty range is a line before it.
+	for _, h := range hunks {
+		if h.oldLines == 0 {
+			h.oldStart--
+		}
+
+		if h.newLines == 0 {
+			h.newStart--
+		}
+	}
+
+	return hunks
+}
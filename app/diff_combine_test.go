@@ -0,0 +1,127 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test_combineDiffs_series checks combined diffs of random patch series against the first and the last versions.
+func Test_combineDiffs_series(t *testing.T) {
+	tmp := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+
+	// diff returns a patch between two versions of file.
+	diff := func(from, to []string) *unifiedDiff {
+		a, b := filepath.Join(tmp, "a", "f.go"), filepath.Join(tmp, "b", "f.go")
+
+		require.NoError(t, os.MkdirAll(filepath.Dir(a), 0o700))
+		require.NoError(t, os.MkdirAll(filepath.Dir(b), 0o700))
+		require.NoError(t, os.WriteFile(a, []byte(strings.Join(from, "")), 0o600))
+		require.NoError(t, os.WriteFile(b, []byte(strings.Join(to, "")), 0o600))
+
+		cmd := exec.Command("git", "diff", "--no-index", "--no-color", "a/f.go", "b/f.go")
+		cmd.Dir = tmp
+		o, err := cmd.Output()
+
+		// Exit code is 1 when files differ.
+		var exitErr *exec.ExitError
+		if err != nil && (!errors.As(err, &exitErr) || exitErr.ExitCode() != 1) {
+			require.NoError(t, err)
+		}
+
+		d, err := parseDiff(bytes.NewReader(o))
+		require.NoError(t, err)
+
+		// Both versions are the same file of a series.
+		for _, fd := range d.files {
+			fd.oldName, fd.newName, fd.status = "f.go", "f.go", fileModified
+		}
+
+		return d
+	}
+
+	// edit returns a version with random lines removed, replaced and inserted, lines are repeated often.
+	edit := func(lines []string) []string {
+		var res []string
+
+		for _, l := range lines {
+			switch rnd.Intn(6) {
+			case 0:
+				continue
+			case 1:
+				res = append(res, fmt.Sprintf("line %d\n", rnd.Intn(8)))
+			case 2:
+				res = append(res, fmt.Sprintf("line %d\n", rnd.Intn(8)), l)
+			default:
+				res = append(res, l)
+			}
+		}
+
+		return append(res, fmt.Sprintf("line %d\n", rnd.Intn(8)))
+	}
+
+	for run := 0; run < 200; run++ {
+		versions := [][]string{edit(nil)}
+		for len(versions[0]) < 10 {
+			versions[0] = edit(versions[0])
+		}
+
+		var diffs []*unifiedDiff
+
+		for i := 0; i < 2+rnd.Intn(3); i++ {
+			next := edit(versions[len(versions)-1])
+			diffs = append(diffs, diff(versions[len(versions)-1], next))
+			versions = append(versions, next)
+		}
+
+		first, last := versions[0], versions[len(versions)-1]
+		direct := diff(first, last)
+
+		var patches []*unifiedDiff
+
+		for _, d := range diffs {
+			if len(d.files) > 0 {
+				patches = append(patches, d)
+			}
+		}
+
+		if len(patches) == 0 || len(direct.files) == 0 {
+			continue
+		}
+
+		combined := combineDiffs(patches)
+		require.Len(t, combined.files, 1)
+
+		fd := combined.files[0]
+
+		for _, h := range fd.hunks {
+			for _, l := range h.lines {
+				switch l.kind {
+				case lineRemoved:
+					require.Equal(t, first[l.oldNum-1], l.content+"\n", "run %d, old line %d", run, l.oldNum)
+				case lineAdded:
+					require.Equal(t, last[l.newNum-1], l.content+"\n", "run %d, new line %d", run, l.newNum)
+				}
+			}
+		}
+
+		// Reverse applied combined and direct diffs restore the first version.
+		old, err := reverseApply([]byte(strings.Join(last, "")), fd.hunks)
+		require.NoError(t, err, "run %d", run)
+		assert.Equal(t, strings.Join(first, ""), string(old), "run %d", run)
+
+		old, err = reverseApply([]byte(strings.Join(last, "")), direct.files[0].hunks)
+		require.NoError(t, err, "run %d", run)
+		assert.Equal(t, strings.Join(first, ""), string(old), "run %d", run)
+	}
+}
@@ -0,0 +1,465 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unifiedDiff is a parsed unified diff with git extended headers.
+type unifiedDiff struct {
+	files []*fileDiff
+
+	// submodules are paths of submodules with expanded diffs.
+	submodules []string
+}
+
+// fileStatus describes how a file is changed.
+type fileStatus string
+
+const (
+	fileModified fileStatus = "modified"
+	fileAdded    fileStatus = "added"
+	fileDeleted  fileStatus = "deleted"
+	fileRenamed  fileStatus = "renamed"
+	fileCopied   fileStatus = "copied"
+)
+
+// fileDiff is a change of a single file.
+type fileDiff struct {
+	oldName, newName string // Empty for added and deleted files respectively.
+	oldMode, newMode string // Empty if not available in headers.
+	status           fileStatus
+	binary           bool
+	hunks            []*diffHunk
+}
+
+// diffHunk is a group of changed lines with context.
+type diffHunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	section            string // Text after hunk range, usually enclosing function.
+	lines              []diffLine
+}
+
+// lineKind is a prefix of line in diff hunk.
+type lineKind byte
+
+const (
+	lineContext lineKind = ' '
+	lineAdded   lineKind = '+'
+	lineRemoved lineKind = '-'
+)
+
+// diffLine is a line of diff hunk.
+type diffLine struct {
+	kind      lineKind
+	oldNum    int // Line number in old file, 0 for added lines.
+	newNum    int // Line number in new file, 0 for removed lines.
+	content   string
+	noNewline bool // Line is followed by "\ No newline at end of file".
+}
+
+// header returns hunk range header.
+func (h *diffHunk) header() string {
+	return strings.TrimSpace(fmt.Sprintf("@@ -%d,%d +%d,%d @@ %s", h.oldStart, h.oldLines, h.newStart, h.newLines, h.section))
+}
+
+var hunkRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@ ?(.*)$`)
+
+// parseDiff parses unified diff, as produced by git diff or diff -u.
+func parseDiff(r io.Reader) (*unifiedDiff, error) {
+	p := diffParser{s: bufio.NewScanner(r), d: &unifiedDiff{}}
+	p.s.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	if err := p.parse(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", p.lineNum, err)
+	}
+
+	return p.d, nil
+}
+
+type diffParser struct {
+	s       *bufio.Scanner
+	d       *unifiedDiff
+	lineNum int
+
+	// git is true if current file has diff --git header.
+	git  bool
+	file *fileDiff
+	hunk *diffHunk
+
+	// Remaining lines of current hunk.
+	oldLeft, newLeft int
+	oldNum, newNum   int
+
+	// Pending line, if it was peeked.
+	pending *string
+}
+
+func (p *diffParser) next() (string, bool) {
+	if p.pending != nil {
+		l := *p.pending
+		p.pending = nil
+
+		return l, true
+	}
+
+	if !p.s.Scan() {
+		return "", false
+	}
+
+	p.lineNum++
+
+	return strings.TrimSuffix(p.s.Text(), "\r"), true
+}
+
+func (p *diffParser) unread(l string) {
+	p.pending = &l
+}
+
+func (p *diffParser) parse() error {
+	for {
+		l, ok := p.next()
+		if !ok {
+			break
+		}
+
+		if p.hunk != nil && (p.oldLeft > 0 || p.newLeft > 0) {
+			if err := p.hunkLine(l); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(l, `\ `) && p.hunk != nil:
+			// No newline at end of file marker after the last line of hunk.
+			if n := len(p.hunk.lines); n > 0 {
+				p.hunk.lines[n-1].noNewline = true
+			}
+		case strings.HasPrefix(l, "diff --git "):
+			if err := p.gitHeader(l); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l, "--- ") && p.file != nil && p.git && p.hunk == nil:
+			if err := p.fileNames(l); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l, "--- "):
+			// Plain unified diff without git header.
+			n, ok := p.next()
+			if !ok || !strings.HasPrefix(n, "+++ ") {
+				if ok {
+					p.unread(n)
+				}
+
+				continue
+			}
+
+			p.git = false
+			p.file = &fileDiff{status: fileModified}
+			p.hunk = nil
+			p.d.files = append(p.d.files, p.file)
+
+			if err := p.fileNames(l); err != nil {
+				return err
+			}
+
+			if err := p.fileNames(n); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l, "+++ ") && p.file != nil && p.git && p.hunk == nil:
+			if err := p.fileNames(l); err != nil {
+				return err
+			}
+		case strings.HasPrefix(l, "@@ ") && p.file != nil:
+			if err := p.hunkHeader(l); err != nil {
+				return err
+			}
+		case p.file != nil && p.git && p.hunk == nil:
+			if err := p.extendedHeader(l); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := p.s.Err(); err != nil {
+		return err
+	}
+
+	if p.hunk != nil && (p.oldLeft > 0 || p.newLeft > 0) {
+		return fmt.Errorf("unexpected end of hunk %s in %s", p.hunk.header(), p.file.name())
+	}
+
+	return nil
+}
+
+func (p *diffParser) gitHeader(l string) error {
+	p.git = true
+	p.hunk = nil
+	p.file = &fileDiff{status: fileModified}
+	p.d.files = append(p.d.files, p.file)
+
+	// Names are only taken from header if they are not available in other headers,
+	// for example for mode changes and binary files.
+	oldName, newName, err := splitGitHeaderNames(strings.TrimPrefix(l, "diff --git "))
+	if err != nil {
+		return err
+	}
+
+	p.file.oldName = strings.TrimPrefix(oldName, "a/")
+	p.file.newName = strings.TrimPrefix(newName, "b/")
+
+	return nil
+}
+
+func (p *diffParser) extendedHeader(l string) error {
+	f := p.file
+
+	var err error
+
+	switch {
+	case strings.HasPrefix(l, "old mode "):
+		f.oldMode = strings.TrimPrefix(l, "old mode ")
+	case strings.HasPrefix(l, "new mode "):
+		f.newMode = strings.TrimPrefix(l, "new mode ")
+	case strings.HasPrefix(l, "index "):
+		// Mode of unchanged file type follows object hashes, for example "index 1f2e3d4..5c6b7a8 160000".
+		if fields := strings.Fields(l); len(fields) == 3 && f.oldMode == "" && f.newMode == "" {
+			f.oldMode, f.newMode = fields[2], fields[2]
+		}
+	case strings.HasPrefix(l, "deleted file mode "):
+		f.oldMode = strings.TrimPrefix(l, "deleted file mode ")
+		f.status = fileDeleted
+		f.newName = ""
+	case strings.HasPrefix(l, "new file mode "):
+		f.newMode = strings.TrimPrefix(l, "new file mode ")
+		f.status = fileAdded
+		f.oldName = ""
+	case strings.HasPrefix(l, "rename from "):
+		f.status = fileRenamed
+		f.oldName, err = unquotePath(strings.TrimPrefix(l, "rename from "))
+	case strings.HasPrefix(l, "rename to "):
+		f.status = fileRenamed
+		f.newName, err = unquotePath(strings.TrimPrefix(l, "rename to "))
+	case strings.HasPrefix(l, "copy from "):
+		f.status = fileCopied
+		f.oldName, err = unquotePath(strings.TrimPrefix(l, "copy from "))
+	case strings.HasPrefix(l, "copy to "):
+		f.status = fileCopied
+		f.newName, err = unquotePath(strings.TrimPrefix(l, "copy to "))
+	case strings.HasPrefix(l, "Binary files ") || l == "GIT binary patch":
+		f.binary = true
+	}
+
+	return err
+}
+
+// fileNames reads file name from "---" or "+++" line.
+func (p *diffParser) fileNames(l string) error {
+	name := l[4:]
+
+	// Plain diff may have a timestamp after tab.
+	if !strings.HasPrefix(name, `"`) {
+		if i := strings.Index(name, "\t"); i >= 0 {
+			name = name[:i]
+		}
+	}
+
+	name, err := unquotePath(name)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(l, "--- ") {
+		if name == "/dev/null" {
+			p.file.oldName = ""
+			p.file.status = fileAdded
+
+			return nil
+		}
+
+		p.file.oldName = strings.TrimPrefix(name, "a/")
+
+		return nil
+	}
+
+	if name == "/dev/null" {
+		p.file.newName = ""
+		p.file.status = fileDeleted
+
+		return nil
+	}
+
+	p.file.newName = strings.TrimPrefix(name, "b/")
+
+	return nil
+}
+
+func (p *diffParser) hunkHeader(l string) error {
+	m := hunkRe.FindStringSubmatch(l)
+	if m == nil {
+		return fmt.Errorf("bad hunk header %q", l)
+	}
+
+	h := &diffHunk{
+		oldStart: atoiDefault(m[1], 0),
+		oldLines: atoiDefault(m[2], 1),
+		newStart: atoiDefault(m[3], 0),
+		newLines: atoiDefault(m[4], 1),
+		section:  m[5],
+	}
+
+	p.hunk = h
+	p.file.hunks = append(p.file.hunks, h)
+	p.oldLeft, p.newLeft = h.oldLines, h.newLines
+	p.oldNum, p.newNum = h.oldStart, h.newStart
+
+	return nil
+}
+
+func (p *diffParser) hunkLine(l string) error {
+	if strings.HasPrefix(l, `\ `) {
+		if n := len(p.hunk.lines); n > 0 {
+			p.hunk.lines[n-1].noNewline = true
+		}
+
+		return nil
+	}
+
+	// Empty context lines may lose their leading space in transit.
+	if l == "" {
+		l = " "
+	}
+
+	dl := diffLine{kind: lineKind(l[0]), content: l[1:]}
+
+	switch dl.kind {
+	case lineContext:
+		dl.oldNum, dl.newNum = p.oldNum, p.newNum
+		p.oldNum++
+		p.newNum++
+		p.oldLeft--
+		p.newLeft--
+	case lineAdded:
+		dl.newNum = p.newNum
+		p.newNum++
+		p.newLeft--
+	case lineRemoved:
+		dl.oldNum = p.oldNum
+		p.oldNum++
+		p.oldLeft--
+	default:
+		return fmt.Errorf("unexpected line in hunk %s of %s: %q", p.hunk.header(), p.file.name(), l)
+	}
+
+	if p.oldLeft < 0 || p.newLeft < 0 {
+		return fmt.Errorf("hunk %s of %s has more lines than expected", p.hunk.header(), p.file.name())
+	}
+
+	p.hunk.lines = append(p.hunk.lines, dl)
+
+	return nil
+}
+
+// name returns new name of file, or old name of deleted file.
+func (f *fileDiff) name() string {
+	if f.newName != "" {
+		return f.newName
+	}
+
+	return f.oldName
+}
+
+// splitGitHeaderNames splits names of "diff --git" header, names may be quoted.
+func splitGitHeaderNames(s string) (string, string, error) {
+	if strings.HasPrefix(s, `"`) {
+		i := closingQuote(s)
+		if i < 0 {
+			return "", "", fmt.Errorf("bad quoted name in diff header %q", s)
+		}
+
+		oldName, err := unquotePath(s[:i+1])
+		if err != nil {
+			return "", "", err
+		}
+
+		newName, err := unquotePath(strings.TrimPrefix(s[i+1:], " "))
+
+		return oldName, newName, err
+	}
+
+	if strings.HasSuffix(s, `"`) {
+		i := strings.Index(s, ` "`)
+		if i < 0 {
+			return "", "", fmt.Errorf("bad quoted name in diff header %q", s)
+		}
+
+		newName, err := unquotePath(s[i+1:])
+
+		return s[:i], newName, err
+	}
+
+	// Unquoted names may contain spaces, but names are equal unless file is renamed
+	// and renames have names in extended headers.
+	if len(s)%2 == 1 {
+		half := len(s) / 2
+		oldName, newName := s[:half], s[half+1:]
+
+		if s[half] == ' ' && strings.TrimPrefix(oldName, "a/") == strings.TrimPrefix(newName, "b/") {
+			return oldName, newName, nil
+		}
+	}
+
+	if i := strings.Index(s, " b/"); i >= 0 {
+		return s[:i], s[i+1:], nil
+	}
+
+	return "", "", fmt.Errorf("bad diff header names %q", s)
+}
+
+// closingQuote returns index of quote that closes quoted string at the beginning of s.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unquotePath decodes C-style quoted path of git, unquoted paths are returned as is.
+func unquotePath(s string) (string, error) {
+	if !strings.HasPrefix(s, `"`) {
+		return s, nil
+	}
+
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("bad quoted path %s: %w", s, err)
+	}
+
+	return u, nil
+}
+
+func atoiDefault(s string, def int) int {
+	if s == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return def
+	}
+
+	return i
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseDiff(t *testing.T) {
+	f, err := os.Open("_testdata/extended.diff")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+
+	d, err := parseDiff(f)
+	require.NoError(t, err)
+
+	res := ""
+
+	for _, f := range d.files {
+		res += fmt.Sprintf("%s %q => %q %s=>%s binary:%v\n", f.status, f.oldName, f.newName, f.oldMode, f.newMode, f.binary)
+
+		for _, h := range f.hunks {
+			res += "  " + h.header() + "\n"
+
+			for _, l := range h.lines {
+				if l.kind == lineContext {
+					continue
+				}
+
+				res += fmt.Sprintf("  %c %d %d %q nonl:%v\n", l.kind, l.oldNum, l.newNum, l.content, l.noNewline)
+			}
+		}
+	}
+
+	assert.Equal(t, `modified "bin.dat" => "bin.dat" 100644=>100644 binary:true
+copied "src.go" => "copy.go" 100644=>100644 binary:false
+  @@ -9,5 +9,5 @@ func Another() int {
+  - 12 0 "\treturn 3" nonl:false
+  + 0 12 "\treturn 33" nonl:false
+deleted "gone.go" => "" 100644=> binary:false
+  @@ -1,3 +0,0 @@
+  - 1 0 "package x" nonl:false
+  - 2 0 "" nonl:false
+  - 3 0 "var gone = 1" nonl:false
+modified "naïve.go" => "naïve.go" 100644=>100644 binary:false
+  @@ -1,3 +1,3 @@
+  - 3 0 "var u = 1" nonl:false
+  + 0 3 "var u = 2" nonl:false
+added "" => "new file.go" =>100644 binary:false
+  @@ -0,0 +1,3 @@
+  + 0 1 "package x" nonl:false
+  + 0 2 "" nonl:false
+  + 0 3 "func New() {}" nonl:false
+modified "nonl.go" => "nonl.go" 100644=>100644 binary:false
+  @@ -1,5 +1,5 @@
+  - 4 0 "\treturn 4" nonl:false
+  + 0 4 "\treturn 5" nonl:false
+renamed "old.go" => "renamed.go" 100644=>100644 binary:false
+  @@ -5,7 +5,7 @@ func A() int {
+  - 8 0 "\treturn 2" nonl:false
+  + 0 8 "\treturn 22" nonl:false
+modified "run.sh" => "run.sh" 100644=>100755 binary:false
+modified "with space.go" => "with space.go" 100644=>100644 binary:false
+  @@ -1,3 +1,3 @@
+  - 3 0 "var s = 1" nonl:false
+  + 0 3 "var s = 2" nonl:false
+`, res)
+
+	// Last line of nonl.go is followed by no newline marker.
+	nonl := d.files[5].hunks[0].lines
+	assert.True(t, nonl[len(nonl)-1].noNewline)
+}
+
+func Test_parseDiff_plain(t *testing.T) {
+	d, err := parseDiff(strings.NewReader(`--- foo.go	2024-01-01 00:00:00
++++ foo.go	2024-01-02 00:00:00
+@@ -1 +1,2 @@
+ package foo
++var a = 1
+`))
+	require.NoError(t, err)
+	require.Len(t, d.files, 1)
+	assert.Equal(t, "foo.go", d.files[0].newName)
+	assert.Equal(t, 2, d.files[0].hunks[0].lines[1].newNum)
+}
+
+func Test_parseDiff_truncated(t *testing.T) {
+	_, err := parseDiff(strings.NewReader(`diff --git a/foo.go b/foo.go
+--- a/foo.go
++++ b/foo.go
+@@ -1,3 +1,3 @@
+ package foo
+`))
+	assert.EqualError(t, err, "line 5: unexpected end of hunk @@ -1,3 +1,3 @@ in foo.go")
+}
+
+func Test_splitGitHeaderNames(t *testing.T) {
+	for _, tc := range []struct {
+		header, oldName, newName string
+	}{
+		{header: "a/foo.go b/foo.go", oldName: "a/foo.go", newName: "b/foo.go"},
+		{header: "a/with b/space.go b/with b/space.go", oldName: "a/with b/space.go", newName: "b/with b/space.go"},
+		{header: `"a/na\303\257ve.go" "b/na\303\257ve.go"`, oldName: "a/naïve.go", newName: "b/naïve.go"},
+		{header: `a/plain.go "b/na\303\257ve.go"`, oldName: "a/plain.go", newName: "b/naïve.go"},
+		{header: "a/old.go b/new.go", oldName: "a/old.go", newName: "b/new.go"},
+	} {
+		oldName, newName, err := splitGitHeaderNames(tc.header)
+		require.NoError(t, err, tc.header)
+		assert.Equal(t, tc.oldName, oldName, tc.header)
+		assert.Equal(t, tc.newName, newName, tc.header)
+	}
+}
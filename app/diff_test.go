@@ -0,0 +1,174 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_getDiff_modes(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.Chdir(dir))
+
+	defer func() {
+		require.NoError(t, os.Chdir(wd))
+	}()
+
+	git := func(args ...string) string {
+		o, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(o))
+
+		return strings.TrimSpace(string(o))
+	}
+
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	git("init", "-q")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+
+	write("base.go", "package x\n")
+	git("add", ".")
+	git("commit", "-qm", "base")
+	base := git("rev-parse", "HEAD")
+
+	git("checkout", "-qb", "other")
+	write("other.go", "package x\n\nvar other = 1\n")
+	git("add", ".")
+	git("commit", "-qm", "other")
+
+	git("checkout", "-q", "-")
+	write("committed.go", "package x\n\nvar committed = 1\n")
+	git("add", ".")
+	git("commit", "-qm", "committed")
+	head := git("rev-parse", "HEAD")
+
+	write("staged.go", "package x\n\nvar staged = 1\n")
+	git("add", ".")
+	write("unstaged.go", "package x\n\nvar unstaged = 1\n")
+	git("add", "-N", "unstaged.go")
+	write("untracked.go", "package x\n\nvar a = 1")
+	write("untracked.txt", "x\n")
+
+	files := func(f flags) []string {
+		f.root = dir
+
+		d, err := getDiff(f)
+		require.NoError(t, err)
+
+		var names []string
+
+		for _, fd := range d.files {
+			names = append(names, fd.name())
+		}
+
+		sort.Strings(names)
+
+		return names
+	}
+
+	assert.Equal(t, []string{"committed.go", "staged.go", "unstaged.go"},
+		files(flags{base: base, diffMode: diffWorktree}))
+	assert.Equal(t, []string{"committed.go", "staged.go", "unstaged.go", "untracked.go"},
+		files(flags{base: base, diffMode: diffWorktree, untracked: true}))
+	assert.Equal(t, []string{"staged.go"},
+		files(flags{diffMode: diffStaged}))
+	assert.Equal(t, []string{"committed.go"},
+		files(flags{base: base, diffMode: diffCommitted}))
+
+	// Changes of other branch are reverted in two-dot diff, but not in three-dot diff.
+	assert.Equal(t, []string{"committed.go", "other.go"},
+		files(flags{base: "other", head: head}))
+	assert.Equal(t, []string{"committed.go"},
+		files(flags{base: "other", head: head, threeDot: true}))
+
+	f := flags{root: dir, diffMode: diffWorktree, base: head, untracked: true}
+	d, err := getDiff(f)
+	require.NoError(t, err)
+
+	u := d.files[len(d.files)-1]
+	assert.Equal(t, fileAdded, u.status)
+	assert.Equal(t, "untracked.go", u.newName)
+	require.Len(t, u.hunks, 1)
+	assert.Equal(t, "@@ -0,0 +1,3 @@", u.hunks[0].header())
+	assert.Equal(t, diffLine{kind: lineAdded, newNum: 3, content: "var a = 1", noNewline: true}, u.hunks[0].lines[2])
+}
+
+func Test_getDiff_mbox(t *testing.T) {
+	d, err := getDiff(flags{diffFiles: stringsFlag{"_testdata/series.mbox"}})
+	require.NoError(t, err)
+
+	res := ""
+
+	for _, f := range d.files {
+		res += fmt.Sprintf("%s %q => %q\n", f.status, f.oldName, f.newName)
+
+		for _, h := range f.hunks {
+			res += "  " + h.header() + "\n"
+
+			for _, l := range h.lines {
+				n := l.newNum
+				if l.kind == lineRemoved {
+					n = l.oldNum
+				}
+
+				res += fmt.Sprintf("  %c %d %s\n", l.kind, n, l.content)
+			}
+		}
+	}
+
+	// Hunks have line numbers of the first version, lines that are removed and added back are unchanged.
+	assert.Equal(t, `renamed "calc.go" => "math.go"
+  @@ -2,0 +3,5 @@
+  + 3 // Neg negates.
+  + 4 func Neg(a int) int {
+  + 5 	return -a
+  + 6 }
+  + 7 
+  @@ -8,1 +13,1 @@
+  - 8 	return a - b
+  + 13 	return a - b - 0
+  @@ -11,2 +16,6 @@
+  - 11 func Mul(a, b int) int {
+  - 12 	return a * b
+  + 16 func Div(a, b int) int {
+  + 17 	if b == 0 {
+  + 18 		return 0
+  + 19 	}
+  + 20 
+  + 21 	return a / b
+deleted "gone.go" => ""
+`, res)
+
+	// Lines changed by the series are lines changed by direct diff.
+	direct, err := getDiff(flags{diffFiles: stringsFlag{"_testdata/series.diff"}})
+	require.NoError(t, err)
+
+	changed := func(fd *fileDiff) []diffLine {
+		var lines []diffLine
+
+		for _, h := range fd.hunks {
+			for _, l := range h.lines {
+				if l.kind != lineContext {
+					lines = append(lines, diffLine{kind: l.kind, oldNum: l.oldNum, newNum: l.newNum, content: l.content})
+				}
+			}
+		}
+
+		return lines
+	}
+
+	assert.Equal(t, changed(direct.files[1]), changed(d.files[0]))
+}
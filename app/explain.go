@@ -0,0 +1,180 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// explain prints how a changed line was accounted, target is FILE:LINE relative to repository root.
+// Explanation is buffered and written at once, so that write error is returned.
+func explain(f flags, w io.Writer, target string) error {
+	i := strings.LastIndex(target, ":")
+	if i <= 0 {
+		return fmt.Errorf("invalid target %q, FILE:LINE expected", target)
+	}
+
+	fn := target[:i]
+
+	line, err := strconv.Atoi(target[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid line number in %q: %w", target, err)
+	}
+
+	a, err := analyze(f)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer(nil)
+
+	fmt.Fprintf(buf, "Diff hunk of %s:%d:\n", fn, line)
+	explainHunk(buf, a.diff, fn, line)
+
+	fmt.Fprintln(buf, "\nProfile blocks:")
+
+	if err := explainBlocks(buf, a.mapper, f.covFile, fn, line); err != nil {
+		return err
+	}
+
+	explainAssigned(buf, a, fn, line)
+
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write explanation: %w", err)
+	}
+
+	return nil
+}
+
+// explainAssigned prints block assigned to a changed line and function that contains the line.
+func explainAssigned(w *bytes.Buffer, a *analysis, fn string, line int) {
+	fmt.Fprintln(w, "\nAssigned block:")
+
+	lines, ok := a.modified[fn]
+
+	switch b := lines[line]; {
+	case !ok && a.skippedGenerated(fn):
+		fmt.Fprintln(w, "  file is not analyzed: generated code, use -include-generated to count it")
+	case !ok:
+		fmt.Fprintln(w, "  file is not analyzed: not a changed .go file, a test file or excluded")
+	case b == nil:
+		fmt.Fprintln(w, "  none, line is not changed")
+	case b.Count == -1:
+		fmt.Fprintln(w, "  none, line has no statements in profile")
+	default:
+		status := "covered"
+		if b.Count == 0 {
+			status = "not covered"
+		}
+
+		fmt.Fprintf(w, "  %s, %s\n", formatBlock(*b), status)
+	}
+
+	fmt.Fprintln(w, "\nFunction:")
+
+	funcs, err := findFuncs(a.mapper.filePath(fn))
+	if err != nil {
+		fmt.Fprintf(w, "  failed to find functions: %v\n", err)
+
+		return
+	}
+
+	for _, fu := range funcs {
+		if fu.startLine <= line && line <= fu.endLine {
+			fmt.Fprintf(w, "  %s %d.%d,%d.%d\n", fu.name, fu.startLine, fu.startCol, fu.endLine, fu.endCol)
+
+			return
+		}
+	}
+
+	fmt.Fprintln(w, "  none")
+}
+
+// explainHunk prints diff hunk that contains a line of a new file.
+func explainHunk(w *bytes.Buffer, diff *unifiedDiff, fn string, line int) {
+	for _, df := range diff.files {
+		if df.newName != fn {
+			continue
+		}
+
+		for _, h := range df.hunks {
+			if line < h.newStart || line >= h.newStart+h.newLines {
+				continue
+			}
+
+			fmt.Fprintf(w, "  %s\n", h.header())
+
+			for _, l := range h.lines {
+				fmt.Fprintf(w, "  %c%s\n", l.kind, l.content)
+			}
+
+			return
+		}
+
+		fmt.Fprintln(w, "  none, line is not in diff hunks of the file")
+
+		return
+	}
+
+	fmt.Fprintln(w, "  none, file is not in diff")
+}
+
+// explainBlocks prints raw blocks of each profile that overlap a line.
+func explainBlocks(w *bytes.Buffer, mapper *pathMapper, covFiles string, fn string, line int) error {
+	fileNames, err := expandProfiles(covFiles)
+	if err != nil {
+		return err
+	}
+
+	found := false
+
+	for _, fileName := range fileNames {
+		if fileName == "-" {
+			fmt.Fprintln(w, "  -: blocks of stdin are not available, it is already consumed")
+
+			continue
+		}
+
+		cb := func(pfn string, block profileBlock) {
+			if block.StartLine > line || block.EndLine < line || mapper.repoPath(pfn) != fn {
+				return
+			}
+
+			found = true
+
+			fmt.Fprintf(w, "  %s: %s:%s\n", fileName, pfn, formatBlock(block))
+		}
+
+		// Only source of explained file is read for formats with byte offsets.
+		src := func(pfn string) []byte {
+			if mapper.repoPath(pfn) != fn {
+				return nil
+			}
+
+			return readSource(pfn, mapper.filePath(fn))
+		}
+
+		if isCoverDir(fileName) {
+			_, err = parseCoverDir(fileName, cb)
+		} else {
+			_, err = parseProfiles(fileName, src, cb)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+	}
+
+	if !found {
+		fmt.Fprintln(w, "  none")
+	}
+
+	return nil
+}
+
+// formatBlock formats block position, number of statements and count as in text profile.
+func formatBlock(b profileBlock) string {
+	return fmt.Sprintf("%d.%d,%d.%d %d %d", b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+}
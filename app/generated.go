@@ -0,0 +1,41 @@
+package app
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// generatedRe matches the comment of generated code, see https://go.dev/s/generatedcode.
+var generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated checks if file has a comment of generated code before package clause.
+// Missing files are not considered generated.
+func isGenerated(fileName string) bool {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for s.Scan() {
+		line := strings.TrimSuffix(s.Text(), "\r")
+
+		if generatedRe.MatchString(line) {
+			return true
+		}
+
+		if strings.HasPrefix(line, "package ") {
+			return false
+		}
+	}
+
+	return false
+}
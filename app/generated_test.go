@@ -0,0 +1,13 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_isGenerated(t *testing.T) {
+	assert.True(t, isGenerated("_testdata/generated/calc_mock.go"))
+	assert.False(t, isGenerated("_testdata/generated/calc.go"))
+	assert.False(t, isGenerated("_testdata/generated/missing.go"))
+}
@@ -2,48 +2,178 @@ package app
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"os/exec"
+	"sort"
 	"strings"
 )
 
-func forkPointFromLocal() (string, error) {
-	o, err := exec.Command("git", "symbolic-ref", "refs/remotes/origin/HEAD").CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("git symbolic-ref refs/remotes/origin/HEAD: %w", err)
-	}
+// Strategies to find base branch in local repository.
+const (
+	strategyOriginHead    = "origin-head"    // Default branch of origin from refs/remotes/origin/HEAD.
+	strategyRemoteDefault = "remote-default" // The main or master branch of any remote.
+	strategyUpstream      = "upstream"       // Upstream tracking branch of current branch.
+)
 
-	baseBranch := strings.TrimSpace(strings.TrimPrefix(string(o), "refs/remotes/"))
+var baseBranchStrategies = map[string]func() (string, bool){
+	strategyOriginHead: func() (string, bool) {
+		o, err := exec.Command("git", "symbolic-ref", "refs/remotes/origin/HEAD").Output()
+		if err != nil {
+			return "", false
+		}
 
-	o, err = exec.Command("git", "merge-base", baseBranch, "--fork-point").CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("git merge-base %s --fork-point: %w", baseBranch, err)
+		return strings.TrimSpace(string(o)), true
+	},
+	strategyRemoteDefault: func() (string, bool) {
+		o, err := exec.Command("git", "remote").Output()
+		if err != nil {
+			return "", false
+		}
+
+		remotes := strings.Fields(string(o))
+
+		// The origin is preferred over other remotes.
+		sort.SliceStable(remotes, func(i, j int) bool { return remotes[i] == "origin" && remotes[j] != "origin" })
+
+		for _, r := range remotes {
+			for _, b := range []string{"main", "master"} {
+				ref := "refs/remotes/" + r + "/" + b
+
+				if err := exec.Command("git", "rev-parse", "--verify", "--quiet", ref).Run(); err == nil {
+					return ref, true
+				}
+			}
+		}
+
+		return "", false
+	},
+	strategyUpstream: func() (string, bool) {
+		o, err := exec.Command("git", "rev-parse", "--symbolic-full-name", "@{upstream}").Output()
+		if err != nil {
+			return "", false
+		}
+
+		return strings.TrimSpace(string(o)), true
+	},
+}
+
+// forkPointFromLocal finds base branch with strategies in order and returns its fork point of HEAD.
+// If reflog of base branch has no fork point, merge base is used.
+func forkPointFromLocal(strategies []string) (string, error) {
+	for _, s := range strategies {
+		find, ok := baseBranchStrategies[s]
+		if !ok {
+			return "", fmt.Errorf("unknown fork point strategy %q", s)
+		}
+
+		baseBranch, ok := find()
+		if !ok {
+			continue
+		}
+
+		baseBranch = strings.TrimPrefix(baseBranch, "refs/remotes/")
+
+		o, err := exec.Command("git", "merge-base", "--fork-point", baseBranch).Output()
+		if fp := strings.TrimSpace(string(o)); err == nil && fp != "" {
+			log.Printf("fork point %s is detected with %s strategy as fork point of %s", fp, s, baseBranch)
+
+			return fp, nil
+		}
+
+		o, err = exec.Command("git", "merge-base", baseBranch, "HEAD").CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git merge-base %s HEAD: %w\n%s", baseBranch, err, string(o))
+		}
+
+		fp := strings.TrimSpace(string(o))
+
+		log.Printf("fork point %s is detected with %s strategy as merge base of %s", fp, s, baseBranch)
+
+		return fp, nil
 	}
 
-	return strings.TrimSpace(string(o)), nil
+	return "", fmt.Errorf("base branch is not found with strategies %s, set -base", strings.Join(strategies, ", "))
+}
+
+// zeroSHA is a before commit of push event that creates a branch.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// githubEvent is a payload of GitHub Actions event, only fields of supported events are decoded.
+type githubEvent struct {
+	// pull_request and pull_request_target.
+	PullRequest *githubPullRequest `json:"pull_request"`
+
+	// push, checkout is the pushed commit.
+	Before     string `json:"before"`
+	Repository struct {
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+
+	// merge_group, checkout is the head of merge group.
+	MergeGroup *struct {
+		BaseSHA string `json:"base_sha"`
+	} `json:"merge_group"`
+
+	// workflow_run.
+	WorkflowRun *struct {
+		HeadSHA      string              `json:"head_sha"`
+		PullRequests []githubPullRequest `json:"pull_requests"`
+	} `json:"workflow_run"`
 }
 
-func forkPointFromGitHub(eventPath string) (string, error) {
+type githubPullRequest struct {
+	Base struct {
+		SHA string `json:"sha"`
+	} `json:"base"`
+	Head struct {
+		SHA string `json:"sha"`
+	} `json:"head"`
+}
+
+// baseFromGitHub returns base of changes from payload of GitHub Actions event.
+func baseFromGitHub(eventName, eventPath string) (ciBase, error) {
 	f, err := ioutil.ReadFile(eventPath)
 	if err != nil {
-		return "", err
-	}
-	// pull_request.base.sha
-	type event struct {
-		PullRequest struct {
-			Base struct {
-				SHA string `json:"sha"`
-			} `json:"base"`
-		} `json:"pull_request"`
+		return ciBase{}, fmt.Errorf("failed to read GitHub event payload: %w", err)
 	}
 
-	var e event
+	var e githubEvent
 	if err := json.Unmarshal(f, &e); err != nil {
-		println(string(f))
+		return ciBase{}, fmt.Errorf("failed to decode GitHub %s event payload: %w", eventName, err)
+	}
+
+	switch {
+	case (eventName == "pull_request" || eventName == "") && e.PullRequest != nil:
+		// Checkout of pull request is a merge commit of head into base.
+		return ciBase{ref: e.PullRequest.Base.SHA}, nil
+	case eventName == "pull_request_target" && e.PullRequest != nil:
+		// Checkout is the base branch, so changes are taken from the head.
+		return ciBase{ref: e.PullRequest.Base.SHA, head: e.PullRequest.Head.SHA, mergeBase: true}, nil
+	case eventName == "push":
+		if e.Before == "" || e.Before == zeroSHA {
+			if e.Repository.DefaultBranch == "" {
+				return ciBase{}, errors.New("push event of a new branch has no default branch of repository")
+			}
+
+			// New branch is compared with the default branch.
+			return ciBase{ref: e.Repository.DefaultBranch, mergeBase: true}, nil
+		}
+
+		return ciBase{ref: e.Before}, nil
+	case eventName == "merge_group" && e.MergeGroup != nil:
+		return ciBase{ref: e.MergeGroup.BaseSHA}, nil
+	case eventName == "workflow_run" && e.WorkflowRun != nil:
+		if len(e.WorkflowRun.PullRequests) == 0 {
+			return ciBase{}, errors.New("workflow_run event has no pull requests, set -base")
+		}
+
+		pr := e.WorkflowRun.PullRequests[0]
 
-		return "", err
+		return ciBase{ref: pr.Base.SHA, head: e.WorkflowRun.HeadSHA, mergeBase: true}, nil
 	}
 
-	return e.PullRequest.Base.SHA, nil
+	return ciBase{}, fmt.Errorf("unsupported GitHub event %q, set -base or -parent", eventName)
 }
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_forkPointFromLocal(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir(t.TempDir()))
+
+	defer func() {
+		require.NoError(t, os.Chdir(wd))
+	}()
+
+	git := func(args ...string) string {
+		o, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(o))
+
+		return strings.TrimSpace(string(o))
+	}
+
+	git("init", "-q")
+	git("config", "user.email", "test@example.com")
+	git("config", "user.name", "test")
+
+	git("commit", "-q", "--allow-empty", "-m", "a")
+	a := git("rev-parse", "HEAD")
+	git("commit", "-q", "--allow-empty", "-m", "b")
+	b := git("rev-parse", "HEAD")
+	git("checkout", "-qb", "feature")
+	git("commit", "-q", "--allow-empty", "-m", "c")
+
+	strategies := []string{strategyOriginHead, strategyRemoteDefault, strategyUpstream}
+
+	_, err = forkPointFromLocal(strategies)
+	assert.EqualError(t, err, "base branch is not found with strategies origin-head, remote-default, upstream, set -base")
+
+	// Remotes are not fetched, only their refs are needed.
+	git("remote", "add", "origin", "https://example.com/origin.git")
+	git("remote", "add", "upstream", "https://example.com/upstream.git")
+	git("update-ref", "refs/remotes/upstream/main", b)
+
+	fp, err := forkPointFromLocal(strategies)
+	require.NoError(t, err)
+	assert.Equal(t, b, fp)
+
+	git("update-ref", "refs/remotes/origin/develop", a)
+	git("symbolic-ref", "refs/remotes/origin/HEAD", "refs/remotes/origin/develop")
+
+	fp, err = forkPointFromLocal(strategies)
+	require.NoError(t, err)
+	assert.Equal(t, a, fp)
+
+	fp, err = forkPointFromLocal([]string{strategyRemoteDefault})
+	require.NoError(t, err)
+	assert.Equal(t, b, fp)
+
+	_, err = forkPointFromLocal([]string{strategyUpstream})
+	require.Error(t, err)
+
+	git("branch", "-q", "--set-upstream-to=origin/develop")
+
+	fp, err = forkPointFromLocal([]string{strategyUpstream})
+	require.NoError(t, err)
+	assert.Equal(t, a, fp)
+
+	// Diverged branch without reflog has no fork point, merge base is used.
+	d := git("commit-tree", "-p", a, "-m", "d", "HEAD^{tree}")
+	git("update-ref", "refs/remotes/upstream/main", d)
+	git("reflog", "expire", "--expire=now", "--all")
+
+	fp, err = forkPointFromLocal([]string{strategyRemoteDefault})
+	require.NoError(t, err)
+	assert.Equal(t, a, fp)
+}
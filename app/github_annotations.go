@@ -10,13 +10,45 @@ type githubAnnotator struct {
 	w io.Writer
 }
 
-func (a githubAnnotator) printNotTested(fn string) {
+func (a githubAnnotator) printNotTested(fn string, mismatch string) {
 	if a.w == nil {
 		return
 	}
 
-	_, err := fmt.Fprintf(a.w, "File %s is not covered by tests\n"+
-		"::notice file=%s::File is not covered by tests.\n", fn, fn)
+	var err error
+
+	if mismatch != "" {
+		_, err = fmt.Fprintf(a.w, "File %s is missing in coverage profile: %s\n"+
+			"::warning file=%s::File is missing in coverage profile: %s.\n", fn, mismatch, fn, mismatch)
+	} else {
+		_, err = fmt.Fprintf(a.w, "File %s is not covered by tests\n"+
+			"::notice file=%s::File is not covered by tests.\n", fn, fn)
+	}
+
+	if err != nil {
+		log.Fatal("failed to write annotation: ", err)
+	}
+}
+
+func (a githubAnnotator) printNotBuilt(fn string) {
+	if a.w == nil {
+		return
+	}
+
+	_, err := fmt.Fprintf(a.w, "File %s is not built in this configuration\n"+
+		"::notice file=%s::File is not built in this configuration of tests.\n", fn, fn)
+	if err != nil {
+		log.Fatal("failed to write annotation: ", err)
+	}
+}
+
+func (a githubAnnotator) printStale(fn string, stale string) {
+	if a.w == nil {
+		return
+	}
+
+	_, err := fmt.Fprintf(a.w, "Coverage profile of %s may be stale: %s\n"+
+		"::warning file=%s::Coverage profile may be stale: %s.\n", fn, stale, fn, stale)
 	if err != nil {
 		log.Fatal("failed to write annotation: ", err)
 	}
@@ -55,3 +87,47 @@ func (a githubAnnotator) printNotice(fn string, start, end int, lines map[int]*p
 		log.Fatal("failed to write annotation: ", err)
 	}
 }
+
+// printHits prints execution count of a covered block in count mode.
+func (a githubAnnotator) printHits(fn string, start, end int, b profileBlock) {
+	if a.w == nil {
+		return
+	}
+
+	_, err := fmt.Fprintf(a.w, "%s:%d,%d: %d statement(s) are covered by tests, hit %d time(s)\n"+
+		"::notice file=%s,line=%d,endLine=%d::%d statement(s) are covered by tests, hit %d time(s).\n",
+		fn, start, end, b.NumStmt, b.Count,
+		fn, start, end, b.NumStmt, b.Count)
+	if err != nil {
+		log.Fatal("failed to write annotation: ", err)
+	}
+}
+
+func (a githubAnnotator) printWeak(fn string, start, end int, blocks []profileBlock) {
+	if a.w == nil {
+		return
+	}
+
+	numStmt := 0
+	hits := -1
+
+	for _, b := range blocks {
+		if b.EndLine < start || b.StartLine > end {
+			continue
+		}
+
+		numStmt += b.NumStmt
+
+		if hits == -1 || b.Count < hits {
+			hits = b.Count
+		}
+	}
+
+	_, err := fmt.Fprintf(a.w, "%s:%d,%d: %d statement(s) are weakly covered by tests, hit %d time(s)\n"+
+		"::notice file=%s,line=%d,endLine=%d::%d statement(s) are weakly covered by tests, hit %d time(s).\n",
+		fn, start, end, numStmt, hits,
+		fn, start, end, numStmt, hits)
+	if err != nil {
+		log.Fatal("failed to write annotation: ", err)
+	}
+}
@@ -6,39 +6,76 @@ import (
 	"io"
 	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/bool64/dev/version"
-	"github.com/waigani/diffparser"
 )
 
 type flags struct {
-	diffFile       string
-	parentCommit   string
-	covFile        string
-	module         string
-	ghaAnnotations string
-	exclude        string
-	funcCov        string
-	funcMaxCov     float64
-	funcBaseCov    string
-	targetDeltaCov float64
-	deltaCovFile   string
-	version        bool
+	diffFiles        stringsFlag
+	parentCommit     string
+	base             string
+	head             string
+	threeDot         bool
+	diffMode         string
+	untracked        bool
+	forkStrategy     string
+	semantic         bool
+	movedCode        string
+	submodules       bool
+	covFile          string
+	module           string
+	root             string
+	pathRewrite      stringsFlag
+	pathRewriteFile  string
+	ghaAnnotations   string
+	ghaHits          bool
+	exclude          string
+	includeGenerated bool
+	funcCov          string
+	funcMaxCov       float64
+	funcBaseCov      string
+	targetDeltaCov   float64
+	deltaCovFile     string
+	minHits          int
+	goos             string
+	goarch           string
+	tags             string
+	excludeNotBuilt  bool
+	staleProfile     string
+	version          bool
+
+	// explain is FILE:LINE target of explain subcommand.
+	explain string
 }
 
 func parseFlags() flags {
 	var f flags
 
-	flag.StringVar(&f.diffFile, "diff", "", "Git diff file for changes (optional)")
+	flag.Var(&f.diffFiles, "diff", "Git diff or mbox patch series file for changes, - for stdin, can be repeated to apply patches in order (optional)")
 	flag.StringVar(&f.parentCommit, "parent", "", "Parent commit hash (optional)")
-	flag.StringVar(&f.covFile, "cov", "coverage.txt", "Coverage file")
-	flag.StringVar(&f.module, "mod", "", "Module name to strip from file names (optional)")
+	flag.StringVar(&f.base, "base", "", "Base commit of changes, default is -parent or detected fork point (optional)")
+	flag.StringVar(&f.head, "head", "", "Head commit of changes, implies committed diff mode (optional)")
+	flag.BoolVar(&f.threeDot, "three-dot", false, "Compare with merge base of -base and head, like git diff base...head (optional)")
+	flag.StringVar(&f.diffMode, "diff-mode", diffWorktree, "Changes to analyze: worktree (committed, staged and unstaged), staged or committed")
+	flag.BoolVar(&f.untracked, "untracked", false, "Add untracked .go files as fully added, requires worktree diff mode and no -diff (optional)")
+	flag.StringVar(&f.forkStrategy, "fork-point-strategy", strings.Join([]string{strategyOriginHead, strategyRemoteDefault, strategyUpstream}, ","),
+		"Comma separated strategies to find base branch in local repository, tried in order: "+
+			strategyOriginHead+" (default branch of origin), "+strategyRemoteDefault+" (main or master of any remote), "+
+			strategyUpstream+" (upstream tracking branch)")
+	flag.BoolVar(&f.semantic, "semantic", false, "Ignore changed lines of statements that have formatting or comment changes only (optional)")
+	flag.StringVar(&f.movedCode, "moved-code", movedKeep, "Action for added lines that are moved from removed lines ignoring whitespace: keep them as changed, exclude or report them separately")
+	flag.BoolVar(&f.submodules, "submodules", false, "Expand changes of submodule pointers into diffs of checked out submodules, recursively (optional)")
+	flag.StringVar(&f.covFile, "cov", "coverage.txt", "Coverage file (Go, LCOV, Cobertura or gocov JSON) or GOCOVERDIR directory, or comma separated list of them and glob patterns to merge, - for stdin, gzip and zstd compressed files are supported")
+	flag.StringVar(&f.module, "mod", "", "Module name to strip from file names, disables discovery of modules (optional)")
+	flag.StringVar(&f.root, "root", "", "Repository root that diff paths are relative to, default is git top level directory (optional)")
+	flag.Var(&f.pathRewrite, "path-rewrite", "Rewrite rule for profile file names, 'old-prefix=>new-prefix' or 're:regexp=>replacement', can be repeated (optional)")
+	flag.StringVar(&f.pathRewriteFile, "path-rewrite-file", "", "File with path rewrite rules, one per line, applied after -path-rewrite rules (optional)")
 	flag.StringVar(&f.ghaAnnotations, "gha-annotations", "", "File to store GitHub Actions annotations")
+	flag.BoolVar(&f.ghaHits, "gha-hits", false, "Annotate execution counts of covered changed statements in count/atomic profiles, besides weakly covered ones (optional)")
 	flag.StringVar(&f.exclude, "exclude", "", "Exclude directories by prefix and files by name pattern, comma separated (optional)")
+	flag.BoolVar(&f.includeGenerated, "include-generated", false, "Count changes of files with '// Code generated ... DO NOT EDIT.' header, they are skipped by default (optional)")
 
 	flag.StringVar(&f.funcCov, "func-cov", "", "Current func coverage from 'go tool cover -func', requires -func-base-cov or -func-max-cov (optional)")
 	flag.StringVar(&f.funcBaseCov, "func-base-cov", "", "Base func coverage from 'go tool cover -func', requires -func-cov (optional)")
@@ -46,10 +83,39 @@ func parseFlags() flags {
 
 	flag.Float64Var(&f.targetDeltaCov, "target-delta-cov", 80, "Target coverage of changed lines, to be used together with -delta-cov-file")
 	flag.StringVar(&f.deltaCovFile, "delta-cov-file", "", "File to store delta coverage message")
+	flag.IntVar(&f.minHits, "min-hits", 0, "Min execution count of changed statements in count/atomic profiles, less frequently hit statements are reported as weakly covered (optional)")
+
+	flag.StringVar(&f.goos, "goos", "", "GOOS of test run to evaluate build constraints of changed files, default is GOOS of environment (optional)")
+	flag.StringVar(&f.goarch, "goarch", "", "GOARCH of test run to evaluate build constraints of changed files, default is GOARCH of environment (optional)")
+	flag.StringVar(&f.tags, "tags", "", "Comma separated build tags of test run to evaluate build constraints of changed files (optional)")
+	flag.BoolVar(&f.excludeNotBuilt, "exclude-not-built", false, "Exclude statements of changed files that are not built in test run configuration from coverage (optional)")
+
+	flag.StringVar(&f.staleProfile, "stale-profile", "warn", "Action when profile blocks do not match current sources of changed files: warn or fail")
 
 	flag.BoolVar(&f.version, "version", false, "Show version and exit")
 
-	flag.Parse()
+	args := os.Args[1:]
+	isExplain := len(args) > 0 && args[0] == "explain"
+
+	if isExplain {
+		args = args[1:]
+	}
+
+	_ = flag.CommandLine.Parse(args)
+
+	if isExplain {
+		// Flags are also allowed after FILE:LINE.
+		if flag.NArg() > 0 {
+			f.explain = flag.Arg(0)
+			_ = flag.CommandLine.Parse(flag.Args()[1:])
+		}
+
+		if f.explain == "" || flag.NArg() > 0 {
+			fmt.Fprintln(flag.CommandLine.Output(), "Usage: gocovdiff explain [flags] FILE:LINE")
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+	}
 
 	if f.version {
 		fmt.Println(version.Module("github.com/vearutop/gocovdiff").Version)
@@ -73,12 +139,67 @@ func parseFlags() flags {
 		os.Exit(1)
 	}
 
+	for _, s := range strings.Split(f.forkStrategy, ",") {
+		if _, ok := baseBranchStrategies[s]; !ok {
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	// Stdin can only be read once.
+	for _, fn := range f.diffFiles {
+		if fn == "-" && strings.Contains(","+f.covFile+",", ",-,") {
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	switch f.movedCode {
+	case movedKeep, movedExclude, movedReport:
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	switch f.diffMode {
+	case diffWorktree, diffStaged, diffCommitted:
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	// Untracked files are only a part of worktree changes, not of patch files.
+	if f.untracked && (f.diffMode != diffWorktree || f.head != "" || len(f.diffFiles) > 0) {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if f.head != "" && f.diffMode == diffStaged {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if f.staleProfile != "warn" && f.staleProfile != "fail" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
 	return f
 }
 
 // Main runs application.
 func Main() {
-	if err := run(parseFlags(), os.Stdout); err != nil {
+	f := parseFlags()
+
+	if f.explain != "" {
+		if err := explain(f, os.Stdout, f.explain); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	if err := run(f, os.Stdout); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -108,20 +229,15 @@ func run(f flags, report io.Writer) (err error) {
 		return reportCoverFuncDiff(report, f.module, base, cur)
 	}
 
-	if f.module == "" {
-		o, err := exec.Command("go", "list", "-m").CombinedOutput()
-		if err != nil {
-			return fmt.Errorf("failed to get module name: %w", err)
-		}
-
-		f.module = strings.TrimSpace(string(o))
-	}
-
-	diff, err := getDiff(f.diffFile, f.parentCommit)
+	a, err := analyze(f)
 	if err != nil {
 		return err
 	}
 
+	if len(a.stale) > 0 && f.staleProfile == "fail" {
+		return fmt.Errorf("coverage profile is stale, blocks do not match current sources of %s", strings.Join(a.staleFiles(), ", "))
+	}
+
 	var ga githubAnnotator
 
 	if f.ghaAnnotations != "" {
@@ -139,135 +255,60 @@ func run(f flags, report io.Writer) (err error) {
 		}()
 	}
 
-	modified := map[string]map[int]*profileBlock{}
-	exclude := []string(nil)
-
-	if f.exclude != "" {
-		exclude = strings.Split(f.exclude, ",")
-	}
-
-fileLoop:
-	for _, f := range diff.Files {
-		if !strings.HasSuffix(f.NewName, ".go") || strings.HasSuffix(f.NewName, "_test.go") {
-			continue
-		}
-
-		for _, e := range exclude {
-			if strings.HasPrefix(f.NewName, e) {
-				continue fileLoop
-			}
+	var (
+		functions     []stat
+		untestedFiles []string
+		notBuiltFiles []string
+		staleFiles    []string
+		diagnostics   []string
+		moved         []string
+		deletedFuncs  []string
+	)
 
-			if ok, err := filepath.Match(e, filepath.Base(f.NewName)); ok && err == nil {
-				continue fileLoop
-			}
+	if f.movedCode == movedReport {
+		movedFiles := make([]string, 0, len(a.moved))
+		for fn := range a.moved {
+			movedFiles = append(movedFiles, fn)
 		}
 
-		lines := map[int]*profileBlock{}
-
-		for _, h := range f.Hunks {
-			for _, l := range h.NewRange.Lines {
-				if l.Mode == diffparser.UNCHANGED {
-					continue
-				}
+		sort.Strings(movedFiles)
 
-				lines[l.Number] = &profileBlock{Count: -1}
+		for _, fn := range movedFiles {
+			for _, mb := range a.moved[fn] {
+				moved = append(moved, mb.String())
 			}
 		}
-
-		modified[f.NewName] = lines
 	}
 
-	testedFiles := map[string]bool{}
-	totStmt := 0
-	covStmt := 0
-	fileCoverage := map[string]stat{}
-
-	err = parseProfiles(f.covFile, func(fn string, block profileBlock) {
-		fn = strings.TrimPrefix(fn, f.module+"/")
-		testedFiles[fn] = true
-		fStat := fileCoverage[fn]
+	for _, fn := range a.changedFiles {
+		if stale := a.stale[fn]; stale != "" {
+			ga.printStale(fn, stale)
 
-		lines, ok := modified[fn]
-		if !ok {
-			return
+			staleFiles = append(staleFiles, fn+": "+stale)
 		}
 
-		totCounted := false
-		for i := block.StartLine; i <= block.EndLine; i++ {
-			l, ok := lines[i]
-			if !ok {
-				continue
-			}
-
-			if !totCounted {
-				totStmt += block.NumStmt
-				fStat.totStmt += block.NumStmt
-
-				if block.Count > 0 {
-					covStmt += block.NumStmt
-					fStat.covStmt += block.NumStmt
-				}
-
-				totCounted = true
+		if !a.testedFiles[fn] {
+			mismatch := a.mismatches[fn]
+			if mismatch != "" {
+				diagnostics = append(diagnostics, fn+": "+mismatch)
 			}
 
-			if l.Count == -1 {
-				lines[i] = &block
+			switch {
+			case a.notBuilt[fn]:
+				ga.printNotBuilt(fn)
 
-				continue
-			}
-
-			// Do not merge blocks that has coverage.
-			if block.Count > 0 {
-				continue
-			}
-
-			l.NumStmt += block.NumStmt
-
-			if l.StartLine == block.StartLine && l.StartCol > block.StartCol {
-				l.StartCol = block.StartCol
-			}
-
-			if l.StartLine > block.StartLine {
-				l.StartLine = block.StartLine
-				l.StartCol = block.StartCol
-			}
+				notBuiltFiles = append(notBuiltFiles, fn)
+			case a.fileCoverage[fn].totStmt == 0:
+				// Files with counted statements are reported as not covered.
+				ga.printNotTested(fn, mismatch)
 
-			if l.EndLine == block.EndLine && l.EndCol < block.EndCol {
-				l.EndCol = block.EndCol
-			}
-
-			if l.EndLine < block.EndLine {
-				l.EndLine = block.EndLine
-				l.EndCol = block.EndCol
+				untestedFiles = append(untestedFiles, fn)
+			default:
+				ga.printNotTested(fn, mismatch)
 			}
 		}
 
-		fileCoverage[fn] = fStat
-	})
-	if err != nil {
-		return fmt.Errorf("failed to parse profiles: %w", err)
-	}
-
-	files := make([]string, 0, len(modified))
-	for fn := range modified {
-		files = append(files, fn)
-	}
-
-	sort.Strings(files)
-
-	var (
-		functions     []stat
-		untestedFiles []string
-	)
-
-	for _, fn := range files {
-		if !testedFiles[fn] {
-			ga.printNotTested(fn)
-			untestedFiles = append(untestedFiles, fn)
-		}
-
-		lines := modified[fn]
+		lines := a.modified[fn]
 
 		ll := make([]int, 0, len(lines))
 
@@ -277,34 +318,50 @@ fileLoop:
 			}
 		}
 
-		if len(ll) > 0 {
-			sort.Ints(ll)
+		for _, r := range lineRanges(ll) {
+			ga.printNotice(fn, r[0], r[1], lines)
+		}
 
-			p := ll[0]
-			start := 0
+		var (
+			weakBlocks []profileBlock
+			wl         []int
+		)
 
-			for _, i := range ll {
-				if start == 0 {
-					start = p
-				}
+		for _, b := range a.changedBlocks[fn] {
+			if b.Count == 0 || !a.countMode {
+				continue
+			}
 
-				if i-p > 1 {
-					ga.printNotice(fn, start, p, lines)
+			var bl []int
 
-					start = 0
+			for i := b.StartLine; i <= b.EndLine; i++ {
+				if _, ok := lines[i]; ok {
+					bl = append(bl, i)
 				}
+			}
 
-				p = i
+			if b.Count < a.minHits {
+				weakBlocks = append(weakBlocks, b)
+				wl = append(wl, bl...)
+
+				continue
 			}
 
-			if start == 0 {
-				start = p
+			// Annotations of all covered blocks are opt-in, as number of annotations is limited.
+			if !f.ghaHits {
+				continue
+			}
+
+			for _, r := range lineRanges(bl) {
+				ga.printHits(fn, r[0], r[1], b)
 			}
+		}
 
-			ga.printNotice(fn, start, p, lines)
+		for _, r := range lineRanges(wl) {
+			ga.printWeak(fn, r[0], r[1], weakBlocks)
 		}
 
-		funcs, err := findFuncs(fn)
+		funcs, err := findFuncs(a.mapper.filePath(fn))
 		if err != nil {
 			return fmt.Errorf("failed to find functions: %w", err)
 		}
@@ -312,9 +369,12 @@ fileLoop:
 		for _, fu := range funcs {
 			totStmt := 0
 			covStmt := 0
+			hits := stat{}
+			changed := false
 
 			for i := fu.startLine; i <= fu.endLine; i++ {
 				if l, ok := lines[i]; ok {
+					changed = true
 					totStmt += l.NumStmt
 
 					if l.Count > 0 {
@@ -323,18 +383,44 @@ fileLoop:
 				}
 			}
 
+			for _, b := range a.changedBlocks[fn] {
+				if b.StartLine <= fu.endLine && b.EndLine >= fu.startLine {
+					hits.addHits(b, a.minHits)
+				}
+			}
+
 			if totStmt > 0 {
-				functions = append(functions, stat{
-					name:       fu.name,
-					file:       fn,
-					line:       fu.startLine,
-					covPercent: float64(covStmt) / float64(totStmt) * 100,
-				})
+				hits.name = fu.name
+				hits.file = fn
+				hits.module = a.mapper.moduleOf(fn)
+				hits.line = fu.startLine
+				hits.covPercent = float64(covStmt) / float64(totStmt) * 100
+
+				functions = append(functions, hits)
+			}
+
+			if !changed && a.deletedIn(fn, fu.startLine, fu.endLine) {
+				deletedFuncs = append(deletedFuncs, a.funcCoverage(fn, fu))
 			}
 		}
 	}
 
-	printReport(report, covStmt, totStmt, functions, fileCoverage, untestedFiles)
+	printReport(report, coverageReport{
+		covStmt:       a.covStmt,
+		totStmt:       a.totStmt,
+		total:         a.totHits,
+		functions:     functions,
+		fileCoverage:  a.fileCoverage,
+		untestedFiles: untestedFiles,
+		notBuiltFiles: notBuiltFiles,
+		staleFiles:    staleFiles,
+		diagnostics:   diagnostics,
+		moved:         moved,
+		deletedFuncs:  deletedFuncs,
+		generated:     a.generated,
+		countMode:     a.countMode,
+		minHits:       a.minHits,
+	})
 
 	if f.deltaCovFile == "" {
 		return nil
@@ -353,8 +439,8 @@ fileLoop:
 
 	res := ""
 
-	if totStmt > 0 {
-		deltaCov := float64(covStmt) / float64(totStmt) * 100
+	if a.totStmt > 0 {
+		deltaCov := float64(a.covStmt) / float64(a.totStmt) * 100
 		res = fmt.Sprintf("changed lines: (statements) %.1f%%", deltaCov)
 
 		if deltaCov < f.targetDeltaCov {
@@ -371,8 +457,77 @@ fileLoop:
 
 type stat struct {
 	name             string
+	module           string
 	file             string
 	line             int
 	covPercent       float64
 	covStmt, totStmt int
+
+	// Execution counts of changed statements, available in count/atomic mode.
+	hasHits          bool
+	minHits, maxHits int
+	weakStmt         int
+}
+
+// add accumulates statements and execution counts of another stat.
+func (s *stat) add(o stat) {
+	s.covStmt += o.covStmt
+	s.totStmt += o.totStmt
+	s.weakStmt += o.weakStmt
+
+	if !o.hasHits {
+		return
+	}
+
+	if !s.hasHits || o.minHits < s.minHits {
+		s.minHits = o.minHits
+	}
+
+	if !s.hasHits || o.maxHits > s.maxHits {
+		s.maxHits = o.maxHits
+	}
+
+	s.hasHits = true
+}
+
+// addHits accounts execution count of a block, blocks hit less than minHits times are weakly covered.
+func (s *stat) addHits(block profileBlock, minHits int) {
+	if !s.hasHits || block.Count < s.minHits {
+		s.minHits = block.Count
+	}
+
+	if !s.hasHits || block.Count > s.maxHits {
+		s.maxHits = block.Count
+	}
+
+	s.hasHits = true
+
+	if block.Count > 0 && block.Count < minHits {
+		s.weakStmt += block.NumStmt
+	}
+}
+
+// lineRanges groups sorted line numbers into ranges of consecutive lines.
+func lineRanges(ll []int) [][2]int {
+	if len(ll) == 0 {
+		return nil
+	}
+
+	sort.Ints(ll)
+
+	var res [][2]int
+
+	start := ll[0]
+	p := ll[0]
+
+	for _, i := range ll[1:] {
+		if i-p > 1 {
+			res = append(res, [2]int{start, p})
+			start = i
+		}
+
+		p = i
+	}
+
+	return append(res, [2]int{start, p})
 }
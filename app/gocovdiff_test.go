@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,7 +27,8 @@ func TestRun(t *testing.T) {
 	report := bytes.NewBuffer(nil)
 
 	require.NoError(t, run(flags{
-		diffFile:       "diff.txt",
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
 		covFile:        "coverage.txt",
 		ghaAnnotations: "gha.txt",
 		deltaCovFile:   "delta.txt",
@@ -59,6 +61,379 @@ foo.go:18,20: 2 statement(s) are not covered by tests
 	assert.Equal(t, "changed lines: (statements) 33.3%, coverage is less than 81.5%, consider testing the changes more thoroughly", string(delta))
 }
 
+func TestRun_mergeProfiles(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.unit.txt,coverage.integration.txt",
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 33.3%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 25.0%    |
+| foo.go:5 | foo      | 25.0%    |
+`, report.String())
+}
+
+func TestRun_duplicateBlocks(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	// Profile with blocks repeated for every test package, as produced with -coverpkg.
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.coverpkg.txt",
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 33.3%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 25.0%    |
+| foo.go:5 | foo      | 25.0%    |
+`, report.String())
+}
+
+func TestRun_countMode(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
+		covFile:        "coverage.count.txt",
+		ghaAnnotations: "gha.txt",
+		minHits:        3,
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage | Hits | Weak (<3) |
+|----------|----------|----------|------|-----------|
+| Total    |          | 33.3%    | 0-6  | 1         |
+| bar.go   |          | 50.0%    | 0-6  | 0         |
+| bar.go:3 | Bar      | 50.0%    | 0-6  | 0         |
+| foo.go   |          | 25.0%    | 0-2  | 1         |
+| foo.go:5 | foo      | 25.0%    | 0-2  | 1         |
+`, report.String())
+
+	gha, err := ioutil.ReadFile("gha.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, `bar.go:9,10: 1 statement(s) on lines 8:10 are not covered by tests
+::notice file=bar.go,line=9,endLine=10::1 statement(s) on lines 8:10 are not covered by tests.
+foo.go:7,8: 1 statement(s) on lines 6:8 are not covered by tests
+::notice file=foo.go,line=7,endLine=8::1 statement(s) on lines 6:8 are not covered by tests.
+foo.go:18,20: 2 statement(s) are not covered by tests
+::notice file=foo.go,line=18,endLine=20::2 statement(s) are not covered by tests.
+foo.go:6,6: 1 statement(s) are weakly covered by tests, hit 2 time(s)
+::notice file=foo.go,line=6,endLine=6::1 statement(s) are weakly covered by tests, hit 2 time(s).
+`, string(gha))
+
+	// Execution counts of all covered statements are annotated with -gha-hits.
+	ghaHits := filepath.Join(t.TempDir(), "gha.txt")
+
+	require.NoError(t, run(flags{
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
+		covFile:        "coverage.count.txt",
+		ghaAnnotations: ghaHits,
+		ghaHits:        true,
+		minHits:        3,
+	}, bytes.NewBuffer(nil)))
+
+	gha, err = ioutil.ReadFile(ghaHits)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(gha), `bar.go:8,8: 1 statement(s) are covered by tests, hit 6 time(s)
+::notice file=bar.go,line=8,endLine=8::1 statement(s) are covered by tests, hit 6 time(s).
+`)
+}
+
+func TestRun_workspace(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"monorepo/diff.txt"},
+		root:      "monorepo",
+		covFile:   "monorepo/coverage.txt",
+	}, report))
+
+	assert.Equal(t, `|           File            | Function | Coverage |
+|---------------------------|----------|----------|
+| Total                     |          | 60.0%    |
+| module example.com/a      |          | 100.0%   |
+| a/a.go                    |          | 100.0%   |
+| a/a.go:3                  | A        | 100.0%   |
+| module example.com/b      |          | 50.0%    |
+| b/b.go                    |          | 50.0%    |
+| b/b.go:3                  | B        | 50.0%    |
+| module example.com/shared |          | 0.0%     |
+| shared/shared.go          |          | 0.0%     |
+| shared/shared.go:3        | Shared   | 0.0%     |
+`, report.String())
+}
+
+func TestRun_pathRewrite(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles:       stringsFlag{"diff.txt"},
+		root:            ".",
+		covFile:         "coverage.docker.txt",
+		pathRewriteFile: "path-rewrite.txt",
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 33.3%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 25.0%    |
+| foo.go:5 | foo      | 25.0%    |
+`, report.String())
+}
+
+func TestRun_detectPrefix(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		module:    "github.com/acme/sample",
+		covFile:   "coverage.txt",
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 33.3%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 25.0%    |
+| foo.go:5 | foo      | 25.0%    |
+`, report.String())
+}
+
+func TestRun_pathMismatch(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
+		covFile:        "coverage.mismatch.txt",
+		ghaAnnotations: "gha.txt",
+	}, report))
+
+	// Statements of file with suspected path mismatch are counted as not covered.
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 16.7%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 0.0%     |
+| foo.go:5 | foo      | 0.0%     |
+
+Possible path mismatch between coverage profile and changed files:
+- foo.go: profile has github.com/acme/sample/foo.go, try -mod github.com/acme/sample or -path-rewrite 'github.com/acme/sample/=>'
+`, report.String())
+
+	gha, err := ioutil.ReadFile("gha.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, `bar.go:9,10: 1 statement(s) on lines 8:10 are not covered by tests
+::notice file=bar.go,line=9,endLine=10::1 statement(s) on lines 8:10 are not covered by tests.
+File foo.go is missing in coverage profile: profile has github.com/acme/sample/foo.go, try -mod github.com/acme/sample or -path-rewrite 'github.com/acme/sample/=>'
+::warning file=foo.go::File is missing in coverage profile: profile has github.com/acme/sample/foo.go, try -mod github.com/acme/sample or -path-rewrite 'github.com/acme/sample/=>'.
+foo.go:6,8: 2 statement(s) on lines 5:8 are not covered by tests
+::notice file=foo.go,line=6,endLine=8::2 statement(s) on lines 5:8 are not covered by tests.
+foo.go:18,20: 2 statement(s) are not covered by tests
+::notice file=foo.go,line=18,endLine=20::2 statement(s) are not covered by tests.
+`, string(gha))
+}
+
+func TestRun_untestedFile(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
+		covFile:        "coverage.bar.txt",
+		ghaAnnotations: "gha.txt",
+	}, report))
+
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 16.7%    |
+| bar.go   |          | 50.0%    |
+| bar.go:3 | Bar      | 50.0%    |
+| foo.go   |          | 0.0%     |
+| foo.go:5 | foo      | 0.0%     |
+`, report.String())
+
+	gha, err := ioutil.ReadFile("gha.txt")
+	require.NoError(t, err)
+
+	assert.Equal(t, `bar.go:9,10: 1 statement(s) on lines 8:10 are not covered by tests
+::notice file=bar.go,line=9,endLine=10::1 statement(s) on lines 8:10 are not covered by tests.
+File foo.go is not covered by tests
+::notice file=foo.go::File is not covered by tests.
+foo.go:6,8: 2 statement(s) on lines 5:8 are not covered by tests
+::notice file=foo.go,line=6,endLine=8::2 statement(s) on lines 5:8 are not covered by tests.
+foo.go:18,20: 2 statement(s) are not covered by tests
+::notice file=foo.go,line=18,endLine=20::2 statement(s) are not covered by tests.
+`, string(gha))
+}
+
+func TestRun_buildConstraints(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata/constraints"))
+
+	defer func() {
+		require.NoError(t, os.Chdir("../.."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.txt",
+		module:    "example.com/constraints",
+		goos:      "linux",
+	}, report))
+
+	assert.Equal(t, `|        File        | Function | Coverage |
+|--------------------|----------|----------|
+| Total              |          | 20.0%    |
+| plain.go           |          | 100.0%   |
+| plain.go:3         | Plain    | 100.0%   |
+| plain_windows.go   |          | 0.0%     |
+| plain_windows.go:3 | Windows  | 0.0%     |
+| tagged.go          |          | 0.0%     |
+| tagged.go:5        | Tagged   | 0.0%     |
+
+Not built in this configuration, check -goos, -goarch and -tags:
+- plain_windows.go
+- tagged.go
+`, report.String())
+
+	report.Reset()
+
+	require.NoError(t, run(flags{
+		diffFiles:       stringsFlag{"diff.txt"},
+		root:            ".",
+		covFile:         "coverage.txt",
+		module:          "example.com/constraints",
+		goos:            "linux",
+		excludeNotBuilt: true,
+	}, report))
+
+	assert.Equal(t, `|    File    | Function | Coverage |
+|------------|----------|----------|
+| Total      |          | 100.0%   |
+| plain.go   |          | 100.0%   |
+| plain.go:3 | Plain    | 100.0%   |
+
+Not built in this configuration, check -goos, -goarch and -tags:
+- plain_windows.go
+- tagged.go
+`, report.String())
+
+	report.Reset()
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.txt",
+		module:    "example.com/constraints",
+		goos:      "windows",
+		tags:      "integration",
+	}, report))
+
+	assert.NotContains(t, report.String(), "Not built")
+}
+
+func TestRun_staleProfile(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.stale.txt",
+	}, report))
+
+	assert.Contains(t, report.String(), `
+Coverage profile does not match current sources, it may be stale:
+- bar.go: 1 of 5 block(s) do not match statements of current source
+- foo.go: 5 of 5 block(s) do not match statements of current source
+`)
+
+	err := run(flags{
+		diffFiles:    stringsFlag{"diff.txt"},
+		root:         ".",
+		covFile:      "coverage.stale.txt",
+		staleProfile: "fail",
+	}, report)
+	require.Error(t, err)
+	assert.Equal(t, "coverage profile is stale, blocks do not match current sources of bar.go, foo.go", err.Error())
+}
+
 func TestRun_excludeFiles(t *testing.T) {
 	require.NoError(t, os.Chdir("_testdata"))
 
@@ -69,7 +444,8 @@ func TestRun_excludeFiles(t *testing.T) {
 	report := bytes.NewBuffer(nil)
 
 	require.NoError(t, run(flags{
-		diffFile:       "diff.txt",
+		diffFiles:      stringsFlag{"diff.txt"},
+		root:           ".",
 		covFile:        "coverage.txt",
 		ghaAnnotations: "gha.txt",
 		deltaCovFile:   "delta.txt",
@@ -187,3 +563,237 @@ func TestRun_funcUnderCovered(t *testing.T) {
 | sample/added.go | added    | 60.0%    |
 `, report.String())
 }
+
+func Test_explain(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	out := bytes.NewBuffer(nil)
+
+	require.NoError(t, explain(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.unit.txt,coverage.integration.txt",
+	}, out, "foo.go:6"))
+
+	assert.Equal(t, `Diff hunk of foo.go:6:
+  @@ -1,6 +1,12 @@
+   package sample
+   
+  +var i = 15
+  +
+   func foo(v int) bool {
+  +	if v == i {
+  +		return false
+  +	}
+  +
+   	if v < 2 {
+   		return false
+   	}
+
+Profile blocks:
+  coverage.unit.txt: sample/foo.go:5.22,6.12 1 0
+  coverage.unit.txt: sample/foo.go:6.12,8.3 1 0
+  coverage.integration.txt: sample/foo.go:5.22,6.12 1 1
+  coverage.integration.txt: sample/foo.go:6.12,8.3 1 0
+
+Assigned block:
+  5.22,8.3 2 1, covered
+
+Function:
+  foo 5.1,23.2
+`, out.String())
+
+	out.Reset()
+
+	require.NoError(t, explain(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.txt",
+	}, out, "foo.go:2"))
+
+	assert.Contains(t, out.String(), "Assigned block:\n  none, line is not changed\n")
+	assert.Contains(t, out.String(), "Function:\n  none\n")
+
+	require.Error(t, explain(flags{}, out, "foo.go"))
+
+	// Write error is returned.
+	closed, err := os.Create(filepath.Join(t.TempDir(), "out.txt"))
+	require.NoError(t, err)
+	require.NoError(t, closed.Close())
+
+	err = explain(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		covFile:   "coverage.txt",
+	}, closed, "foo.go:2")
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestRun_movedCode(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata/moved"))
+
+	defer func() {
+		require.NoError(t, os.Chdir("../.."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		module:    "example.com/moved",
+		covFile:   "coverage.txt",
+		movedCode: movedReport,
+	}, report))
+
+	// Area is moved with reindent, Perimeter is new.
+	assert.Equal(t, `|     File     | Function  |  Coverage   |
+|--------------|-----------|-------------|
+| Total        |           | 66.7%       |
+| shapes.go    |           | 66.7%       |
+| shapes.go:18 | Perimeter | 50.0%       |
+| geometry.go  |           | no coverage |
+
+Moved code, not counted as changed:
+- shapes.go:8-15 moved from geometry.go:3-10, 2 of 3 statement(s) covered
+`, report.String())
+
+	report.Reset()
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		module:    "example.com/moved",
+		covFile:   "coverage.txt",
+		movedCode: movedReport,
+		exclude:   "shapes.go",
+	}, report))
+
+	// Moved code of excluded files is not reported.
+	assert.Equal(t, "No changes in testable statements.\n", report.String())
+}
+
+func TestRun_movedCode_notTested(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata/moved"))
+
+	defer func() {
+		require.NoError(t, os.Chdir("../.."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"area.diff"},
+		root:      ".",
+		module:    "example.com/moved",
+		covFile:   "coverage.empty.txt",
+		movedCode: movedReport,
+	}, report))
+
+	// Area is only moved, statements of file missing in profile are not covered.
+	assert.Equal(t, `No changes in testable statements.
+
+Moved code, not counted as changed:
+- shapes.go:8-15 moved from geometry.go:3-10, 0 of 3 statement(s) covered
+
+Possible path mismatch between coverage profile and changed files:
+- geometry.go: profile has no entries of module example.com/moved, check -cov and -mod
+`, report.String())
+}
+
+func TestRun_deletedLines(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata"))
+
+	defer func() {
+		require.NoError(t, os.Chdir(".."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"deleted.diff"},
+		root:      ".",
+		covFile:   "coverage.txt",
+	}, report))
+
+	// Bar only has removed lines, foo has both removed and added lines.
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 0.0%     |
+| foo.go   |          | 0.0%     |
+| foo.go:5 | foo      | 0.0%     |
+
+Functions modified by deletion only, with current coverage:
+- bar.go:3 Bar 71.4%
+`, report.String())
+
+	report.Reset()
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"deleted.diff"},
+		root:      ".",
+		covFile:   "coverage.txt",
+		semantic:  true,
+	}, report))
+
+	// Files with deletions only are kept with semantic diff.
+	assert.Equal(t, `|   File   | Function | Coverage |
+|----------|----------|----------|
+| Total    |          | 0.0%     |
+| foo.go   |          | 0.0%     |
+| foo.go:5 | foo      | 0.0%     |
+
+Functions modified by deletion only, with current coverage:
+- bar.go:3 Bar 71.4%
+`, report.String())
+}
+
+func TestRun_generated(t *testing.T) {
+	require.NoError(t, os.Chdir("_testdata/generated"))
+
+	defer func() {
+		require.NoError(t, os.Chdir("../.."))
+	}()
+
+	report := bytes.NewBuffer(nil)
+
+	require.NoError(t, run(flags{
+		diffFiles: stringsFlag{"diff.txt"},
+		root:      ".",
+		module:    "example.com/calc",
+		covFile:   "coverage.txt",
+	}, report))
+
+	assert.Equal(t, `|   File    | Function | Coverage |
+|-----------|----------|----------|
+| Total     |          | 100.0%   |
+| calc.go   |          | 100.0%   |
+| calc.go:4 | Sum      | 100.0%   |
+
+Generated files skipped, use -include-generated to count them:
+- calc_mock.go
+`, report.String())
+
+	report.Reset()
+
+	require.NoError(t, run(flags{
+		diffFiles:        stringsFlag{"diff.txt"},
+		root:             ".",
+		module:           "example.com/calc",
+		covFile:          "coverage.txt",
+		includeGenerated: true,
+	}, report))
+
+	assert.Equal(t, `|      File       | Function | Coverage |
+|-----------------|----------|----------|
+| Total           |          | 50.0%    |
+| calc.go         |          | 100.0%   |
+| calc.go:4       | Sum      | 100.0%   |
+| calc_mock.go    |          | 0.0%     |
+| calc_mock.go:11 | Sum      | 0.0%     |
+`, report.String())
+}
@@ -0,0 +1,286 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// moduleInfo describes a Go module located in the repository.
+type moduleInfo struct {
+	path string // Module path, for example github.com/org/repo/sub.
+	dir  string // Slash separated directory relative to repository root, empty for root.
+}
+
+// pathMapper maps import path qualified file names of coverage profiles to repository relative paths.
+type pathMapper struct {
+	root    string
+	rules   []rewriteRule
+	modules []moduleInfo
+
+	// detected is applied to mapped file names, see detectPrefix.
+	detected *rewriteRule
+}
+
+// repoRoot returns the top level directory of git repository, or current directory outside of git repository.
+func repoRoot() string {
+	o, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "."
+	}
+
+	return strings.TrimSpace(string(o))
+}
+
+// newPathMapper creates a mapper for modules of repository or workspace in root directory.
+//
+// If module is not empty, it is used as the only module located in root directory.
+// Rewrite rules are applied to file names in order before modules are matched.
+func newPathMapper(root, module string, rules []rewriteRule) (*pathMapper, error) {
+	m := &pathMapper{root: root, rules: rules}
+
+	if module != "" {
+		m.modules = []moduleInfo{{path: module}}
+
+		return m, nil
+	}
+
+	modules, err := discoverModules(root)
+	if err != nil {
+		return nil, err
+	}
+
+	m.modules = modules
+
+	// Longer module paths are matched first to support nested modules.
+	sort.SliceStable(m.modules, func(i, j int) bool {
+		return len(m.modules[i].path) > len(m.modules[j].path)
+	})
+
+	return m, nil
+}
+
+// repoPath converts profile file name to path relative to repository root.
+func (m *pathMapper) repoPath(fn string) string {
+	for _, r := range m.rules {
+		fn = r.apply(fn)
+	}
+
+	for _, mod := range m.modules {
+		if rest := strings.TrimPrefix(fn, mod.path+"/"); rest != fn {
+			fn = path.Join(mod.dir, rest)
+
+			break
+		}
+	}
+
+	if m.detected != nil {
+		fn = m.detected.apply(fn)
+	}
+
+	return fn
+}
+
+// detectPrefix enables automatic prefix replacement if configured mapping
+// does not match profile file names with changed files.
+func (m *pathMapper) detectPrefix(profileFiles []string, changedFiles []string) {
+	mapped := make([]string, 0, len(profileFiles))
+
+	for _, fn := range profileFiles {
+		mapped = append(mapped, m.repoPath(fn))
+	}
+
+	r, cnt, ok := detectPrefix(mapped, changedFiles)
+	if !ok {
+		return
+	}
+
+	m.detected = &r
+
+	log.Printf("detected profile path prefix %q, replaced with %q to match %d changed file(s)", r.prefix, r.repl, cnt)
+}
+
+// moduleOf returns path of the module that contains repository relative file name.
+func (m *pathMapper) moduleOf(fn string) string {
+	res := ""
+	dirLen := -1
+
+	for _, mod := range m.modules {
+		if (mod.dir == "" || strings.HasPrefix(fn, mod.dir+"/")) && len(mod.dir) > dirLen {
+			res = mod.path
+			dirLen = len(mod.dir)
+		}
+	}
+
+	return res
+}
+
+// filePath returns file system path of repository relative file name.
+func (m *pathMapper) filePath(fn string) string {
+	return filepath.Join(m.root, filepath.FromSlash(fn))
+}
+
+// discoverModules finds modules of go.work workspace in root directory, or all go.mod files in root directory.
+// Local replaces of modules are also mapped to their directories.
+func discoverModules(root string) ([]moduleInfo, error) {
+	var modDirs []string
+
+	work, err := os.ReadFile(filepath.Join(root, "go.work"))
+	isWork := err == nil
+
+	switch {
+	case isWork:
+		for _, d := range parseDirectives(work)["use"] {
+			modDirs = append(modDirs, path.Clean(d[0]))
+		}
+	case os.IsNotExist(err):
+		err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				name := d.Name()
+				if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") ||
+					name == "testdata" || name == "vendor" || name == "node_modules") {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			if d.Name() == "go.mod" {
+				rel, err := filepath.Rel(root, filepath.Dir(p))
+				if err != nil {
+					return err
+				}
+
+				modDirs = append(modDirs, filepath.ToSlash(rel))
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find modules: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to read go.work: %w", err)
+	}
+
+	var modules []moduleInfo
+
+	for _, dir := range modDirs {
+		if dir == "." {
+			dir = ""
+		}
+
+		gm, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(dir), "go.mod"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read go.mod: %w", err)
+		}
+
+		directives := parseDirectives(gm)
+
+		if mod := directives["module"]; len(mod) > 0 {
+			modules = append(modules, moduleInfo{path: mod[0][0], dir: dir})
+		}
+
+		modules = append(modules, localReplaces(directives["replace"], dir)...)
+	}
+
+	if isWork {
+		modules = append(modules, localReplaces(parseDirectives(work)["replace"], "")...)
+	}
+
+	unique := modules[:0]
+	seen := map[moduleInfo]bool{}
+
+	for _, mod := range modules {
+		if !seen[mod] {
+			seen[mod] = true
+
+			unique = append(unique, mod)
+		}
+	}
+
+	return unique, nil
+}
+
+// localReplaces returns modules replaced with directories inside repository.
+func localReplaces(replaces [][]string, dir string) []moduleInfo {
+	var modules []moduleInfo
+
+	for _, r := range replaces {
+		// Directive arguments: old [version] => new [version].
+		for i, a := range r {
+			if a != "=>" || i+1 >= len(r) {
+				continue
+			}
+
+			target := r[i+1]
+			if !strings.HasPrefix(target, "./") && !strings.HasPrefix(target, "../") {
+				continue
+			}
+
+			target = path.Join(dir, target)
+			if target == ".." || strings.HasPrefix(target, "../") {
+				continue
+			}
+
+			if target == "." {
+				target = ""
+			}
+
+			modules = append(modules, moduleInfo{path: r[0], dir: target})
+		}
+	}
+
+	return modules
+}
+
+// parseDirectives parses go.mod or go.work file into arguments of directives.
+func parseDirectives(data []byte) map[string][][]string {
+	res := map[string][][]string{}
+	block := ""
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		for i, f := range fields {
+			if u, err := strconv.Unquote(f); err == nil {
+				fields[i] = u
+			}
+		}
+
+		switch {
+		case block != "" && fields[0] == ")":
+			block = ""
+		case block != "":
+			res[block] = append(res[block], fields)
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+		case len(fields) > 1:
+			res[fields[0]] = append(res[fields[0]], fields[1:])
+		}
+	}
+
+	return res
+}
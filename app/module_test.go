@@ -0,0 +1,71 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_discoverModules(t *testing.T) {
+	modules, err := discoverModules("_testdata")
+	require.NoError(t, err)
+
+	assert.Equal(t, []moduleInfo{
+		{path: "sample", dir: ""},
+		{path: "example.com/a", dir: "monorepo/a"},
+		{path: "example.com/b", dir: "monorepo/b"},
+		{path: "example.com/shared", dir: "monorepo/shared"},
+	}, modules)
+
+	m, err := newPathMapper("_testdata", "", nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "monorepo/b/b.go", m.repoPath("example.com/b/b.go"))
+	assert.Equal(t, "bar.go", m.repoPath("sample/bar.go"))
+	assert.Equal(t, "other.com/c.go", m.repoPath("other.com/c.go"))
+	assert.Equal(t, "example.com/a", m.moduleOf("monorepo/a/a.go"))
+	assert.Equal(t, "sample", m.moduleOf("foo.go"))
+}
+
+func Test_pathMapper_rules(t *testing.T) {
+	rules, err := loadRewriteRules([]string{"/src/=>", `re:^/build/[^/]+/(.+)$=>example.com/$1`}, "")
+	require.NoError(t, err)
+
+	m, err := newPathMapper("_testdata", "", rules)
+	require.NoError(t, err)
+
+	assert.Equal(t, "bar.go", m.repoPath("/src/sample/bar.go"))
+	assert.Equal(t, "monorepo/a/a.go", m.repoPath("/build/0123/a/a.go"))
+	assert.Equal(t, "/other/foo.go", m.repoPath("/other/foo.go"))
+
+	_, err = loadRewriteRules([]string{"/src/"}, "")
+	assert.EqualError(t, err, `missing '=>' in path rewrite rule "/src/"`)
+}
+
+func Test_detectPrefix(t *testing.T) {
+	r, cnt, ok := detectPrefix([]string{
+		"github.com/acme/repo/pkg/a.go",
+		"github.com/acme/repo/pkg/b.go",
+		"github.com/acme/repo/other/a.go",
+	}, []string{"svc/pkg/a.go", "svc/pkg/b.go", "svc/new.go"})
+
+	assert.True(t, ok)
+	assert.Equal(t, 2, cnt)
+	assert.Equal(t, rewriteRule{prefix: "github.com/acme/repo/", repl: "svc/"}, r)
+	assert.Equal(t, "svc/pkg/a.go", r.apply("github.com/acme/repo/pkg/a.go"))
+
+	_, _, ok = detectPrefix([]string{"pkg/a.go", "pkg/b.go"}, []string{"pkg/a.go", "pkg/c.go"})
+	assert.False(t, ok)
+}
+
+func Test_pathDiagnostics(t *testing.T) {
+	m, err := newPathMapper("_testdata", "", nil)
+	require.NoError(t, err)
+
+	d := newPathDiagnostics(m, []string{"sample/bar.go", "/src/monorepo/b/b.go"})
+
+	assert.Equal(t, "", d.diagnose("foo.go"))
+	assert.Equal(t, "profile has no entries of module example.com/a, check -cov and -mod", d.diagnose("monorepo/a/a.go"))
+	assert.Equal(t, "profile has /src/monorepo/b/b.go, try -path-rewrite '/src/=>'", d.diagnose("monorepo/b/b.go"))
+}
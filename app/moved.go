@@ -0,0 +1,229 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Actions for moved code.
+const (
+	movedKeep    = "keep"
+	movedExclude = "exclude"
+	movedReport  = "report"
+)
+
+// minMovedAlnum is a minimal number of alphanumeric characters in moved block, as in git diff --color-moved.
+const minMovedAlnum = 20
+
+// movedBlock is a range of added lines that matches removed lines ignoring whitespace.
+type movedBlock struct {
+	file               string
+	startLine, endLine int
+	fromFile           string
+	fromStart, fromEnd int
+
+	// Statements of moved lines in profile.
+	totStmt, covStmt int
+}
+
+// lineRun is a run of consecutive added or removed lines of a file.
+type lineRun struct {
+	file  string
+	lines []diffLine
+	norm  []string
+
+	// indent is leading indentation of lines, it is compared relative to base,
+	// so that code moved into or out of a nested block is not matched.
+	indent []int
+	// base is indentation of enclosing block derived from neighboring context line, -1 if it is not known yet.
+	base int
+}
+
+// tabWidth is a width of tab in indentation, so that code reindented from tabs to spaces keeps its indentation.
+const tabWidth = 4
+
+// indentWidth returns width of leading whitespace of a line.
+func indentWidth(l string) int {
+	w := 0
+
+	for _, r := range l {
+		switch r {
+		case '\t':
+			w += tabWidth
+		case ' ':
+			w++
+		default:
+			return w
+		}
+	}
+
+	return w
+}
+
+// blockIndent returns indentation of statements of the block that encloses a gap next to a context line.
+// Line before the gap that opens a block, or line after the gap that closes a block, is one level less indented.
+func blockIndent(content string, before bool) int {
+	w := indentWidth(content)
+	l := strings.TrimSpace(content)
+
+	if before && (strings.HasSuffix(l, "{") || strings.HasSuffix(l, "(") || strings.HasSuffix(l, ":")) {
+		return w + tabWidth
+	}
+
+	if !before && (strings.HasPrefix(l, "}") || strings.HasPrefix(l, ")")) {
+		return w + tabWidth
+	}
+
+	return w
+}
+
+// matches checks if lines of runs are the same ignoring whitespace and have the same relative indentation.
+func (r *lineRun) matches(i int, o *lineRun, j int) bool {
+	if r.norm[i] != o.norm[j] {
+		return false
+	}
+
+	return r.norm[i] == "" || r.indent[i]-r.base == o.indent[j]-o.base
+}
+
+// detectMoved finds blocks of added lines that are moved from removed lines of any file of diff.
+func detectMoved(diff *unifiedDiff) map[string][]*movedBlock {
+	var added, removed []*lineRun
+
+	for _, fd := range diff.files {
+		for _, h := range fd.hunks {
+			var (
+				cur     *lineRun
+				pending []*lineRun // Runs without preceding context line wait for the following one.
+			)
+
+			base := -1
+
+			for _, l := range h.lines {
+				if cur != nil && cur.lines[0].kind != l.kind {
+					cur = nil
+				}
+
+				if l.kind == lineContext {
+					if strings.TrimSpace(l.content) != "" {
+						for _, r := range pending {
+							r.base = blockIndent(l.content, false)
+						}
+
+						base = blockIndent(l.content, true)
+
+						pending = pending[:0]
+					}
+
+					continue
+				}
+
+				if cur == nil {
+					if l.kind == lineAdded {
+						cur = &lineRun{file: fd.newName, base: base}
+						added = append(added, cur)
+					} else {
+						cur = &lineRun{file: fd.oldName, base: base}
+						removed = append(removed, cur)
+					}
+
+					if base == -1 {
+						pending = append(pending, cur)
+					}
+				}
+
+				cur.lines = append(cur.lines, l)
+				cur.norm = append(cur.norm, strings.Join(strings.Fields(l.content), " "))
+				cur.indent = append(cur.indent, indentWidth(l.content))
+			}
+
+			// Runs of hunks without context lines are compared by their own indentation.
+			for _, r := range pending {
+				r.base = 0
+			}
+		}
+	}
+
+	type linePos struct{ run, idx int }
+
+	index := map[string][]linePos{}
+
+	for ri, r := range removed {
+		for i, n := range r.norm {
+			if n != "" {
+				index[n] = append(index[n], linePos{run: ri, idx: i})
+			}
+		}
+	}
+
+	res := map[string][]*movedBlock{}
+
+	for _, a := range added {
+		for i := 0; i < len(a.lines); {
+			best, bestLen := linePos{}, 0
+
+			for _, p := range index[a.norm[i]] {
+				r := removed[p.run]
+
+				k := 0
+				for i+k < len(a.norm) && p.idx+k < len(r.norm) && a.matches(i+k, r, p.idx+k) {
+					k++
+				}
+
+				if k > bestLen {
+					best, bestLen = p, k
+				}
+			}
+
+			// Trailing blank lines are not a part of moved block.
+			for bestLen > 0 && a.norm[i+bestLen-1] == "" {
+				bestLen--
+			}
+
+			if bestLen == 0 || alnumCount(a.norm[i:i+bestLen]) < minMovedAlnum {
+				i++
+
+				continue
+			}
+
+			from := removed[best.run]
+			res[a.file] = append(res[a.file], &movedBlock{
+				file:      a.file,
+				startLine: a.lines[i].newNum,
+				endLine:   a.lines[i+bestLen-1].newNum,
+				fromFile:  from.file,
+				fromStart: from.lines[best.idx].oldNum,
+				fromEnd:   from.lines[best.idx+bestLen-1].oldNum,
+			})
+
+			i += bestLen
+		}
+	}
+
+	return res
+}
+
+func alnumCount(lines []string) int {
+	n := 0
+
+	for _, l := range lines {
+		for _, r := range l {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				n++
+			}
+		}
+	}
+
+	return n
+}
+
+// String describes moved block with coverage of its statements.
+func (b *movedBlock) String() string {
+	cov := "no statements"
+	if b.totStmt > 0 {
+		cov = fmt.Sprintf("%d of %d statement(s) covered", b.covStmt, b.totStmt)
+	}
+
+	return fmt.Sprintf("%s:%d-%d moved from %s:%d-%d, %s", b.file, b.startLine, b.endLine, b.fromFile, b.fromStart, b.fromEnd, cov)
+}
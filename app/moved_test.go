@@ -0,0 +1,41 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectMoved_nested(t *testing.T) {
+	d, err := parseDiff(strings.NewReader(`diff --git a/foo.go b/foo.go
+index 299c486..3f5ccac 100644
+--- a/foo.go
++++ b/foo.go
+@@ -3,9 +3,11 @@ package foo
+ func Foo(items []string) {
+-	for _, item := range items {
+-		fmt.Println("item of items:", item)
+-	}
++	if len(items) > 0 {
++		for _, item := range items {
++			fmt.Println("item of items:", item)
++		}
++	}
+ }
+ 
+ func Bar(items []string) {
+-	fmt.Println("number of items:", len(items))
+ 	fmt.Println("done")
++	fmt.Println("number of items:", len(items))
+ }
+`))
+	require.NoError(t, err)
+
+	moved := detectMoved(d)
+
+	// Code reindented into a new block is changed, code moved at the same depth is moved.
+	require.Len(t, moved["foo.go"], 1)
+	assert.Equal(t, "foo.go:13-13 moved from foo.go:10-10, no statements", moved["foo.go"][0].String())
+}
@@ -0,0 +1,191 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rewriteRule replaces a prefix or a regular expression match in file names of coverage profiles.
+//
+// Rules are defined as "old=>new" for prefix replacement or "re:expr=>new" for regular expression,
+// the replacement of regular expression can refer to submatches with $1, $2 and so on.
+type rewriteRule struct {
+	prefix string
+	re     *regexp.Regexp
+	repl   string
+}
+
+// parseRewriteRule parses rule definition.
+func parseRewriteRule(s string) (rewriteRule, error) {
+	var r rewriteRule
+
+	pos := strings.LastIndex(s, "=>")
+	if pos == -1 {
+		return r, fmt.Errorf("missing '=>' in path rewrite rule %q", s)
+	}
+
+	old := s[:pos]
+	r.repl = s[pos+2:]
+
+	if expr := strings.TrimPrefix(old, "re:"); expr != old {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return r, fmt.Errorf("bad regular expression in path rewrite rule %q: %w", s, err)
+		}
+
+		r.re = re
+
+		return r, nil
+	}
+
+	if old == "" {
+		return r, fmt.Errorf("empty prefix in path rewrite rule %q", s)
+	}
+
+	r.prefix = old
+
+	return r, nil
+}
+
+// apply rewrites file name.
+func (r rewriteRule) apply(fn string) string {
+	if r.re != nil {
+		return r.re.ReplaceAllString(fn, r.repl)
+	}
+
+	if strings.HasPrefix(fn, r.prefix) {
+		return r.repl + fn[len(r.prefix):]
+	}
+
+	return fn
+}
+
+// loadRewriteRules parses rules from flags and from a file with a rule per line,
+// empty lines and lines starting with # are ignored.
+func loadRewriteRules(rules []string, fileName string) ([]rewriteRule, error) {
+	defs := append([]string(nil), rules...)
+
+	if fileName != "" {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open path rewrite file: %w", err)
+		}
+
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}()
+
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			defs = append(defs, line)
+		}
+
+		if err := s.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read path rewrite file: %w", err)
+		}
+	}
+
+	res := make([]rewriteRule, 0, len(defs))
+
+	for _, d := range defs {
+		r, err := parseRewriteRule(d)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+// detectPrefix finds a prefix replacement that maps most of profile file names to changed files
+// by matching common path suffixes. It returns false if the replacement does not improve current mapping.
+func detectPrefix(profileFiles []string, changedFiles []string) (rewriteRule, int, bool) {
+	byBase := map[string][]string{}
+	profiled := map[string]bool{}
+
+	for _, fn := range profileFiles {
+		byBase[path.Base(fn)] = append(byBase[path.Base(fn)], fn)
+		profiled[fn] = true
+	}
+
+	current := 0
+	candidates := map[rewriteRule]int{}
+
+	for _, d := range changedFiles {
+		if profiled[d] {
+			current++
+		}
+
+		matched := map[rewriteRule]bool{}
+
+		for _, p := range byBase[path.Base(d)] {
+			ps := strings.Split(p, "/")
+			ds := strings.Split(d, "/")
+
+			for len(ps) > 0 && len(ds) > 0 && ps[len(ps)-1] == ds[len(ds)-1] {
+				ps = ps[:len(ps)-1]
+				ds = ds[:len(ds)-1]
+			}
+
+			r := rewriteRule{prefix: strings.Join(ps, "/"), repl: strings.Join(ds, "/")}
+
+			if r.prefix != "" {
+				r.prefix += "/"
+			}
+
+			if r.repl != "" {
+				r.repl += "/"
+			}
+
+			if !matched[r] {
+				matched[r] = true
+				candidates[r]++
+			}
+		}
+	}
+
+	var (
+		best      rewriteRule
+		bestCount int
+	)
+
+	for r, cnt := range candidates {
+		if cnt > bestCount || (cnt == bestCount && r.prefix+"=>"+r.repl < best.prefix+"=>"+best.repl) {
+			best = r
+			bestCount = cnt
+		}
+	}
+
+	if bestCount <= current {
+		return rewriteRule{}, 0, false
+	}
+
+	return best, bestCount, true
+}
+
+// stringsFlag collects values of a repeatable flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+
+	return nil
+}
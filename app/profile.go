@@ -2,15 +2,24 @@ package app
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 // profileBlock represents a single block of profiling data.
+//
+// Zero columns denote a block of whole lines, as line based formats (LCOV, Cobertura) have no columns.
 type profileBlock struct {
 	StartLine, StartCol int
 	EndLine, EndCol     int
@@ -19,13 +28,199 @@ type profileBlock struct {
 
 var lineRe = regexp.MustCompile(`^(.+):([0-9]+).([0-9]+),([0-9]+).([0-9]+) ([0-9]+) ([0-9]+)$`)
 
+// profileSet is a collection of coverage blocks merged from one or more profiles.
+type profileSet struct {
+	mode   string
+	files  []string
+	blocks map[string][]*profileBlock
+	index  map[blockKey]*profileBlock
+	err    error
+
+	// keep filters source files to keep blocks for, all files are kept if nil.
+	keep func(fn string) bool
+	// path returns file system path of a profile file name, file name is used as is if nil.
+	path func(fn string) string
+}
+
+// blockKey identifies a block by source file and position.
+type blockKey struct {
+	fn                  string
+	startLine, startCol int
+	endLine, endCol     int
+}
+
+// loadProfiles parses and merges profiles from a comma separated list of file names and glob patterns.
+// Directories are decoded as binary coverage data (GOCOVERDIR), "-" is read from stdin.
+// Blocks are only kept for source files accepted by keep, if it is not nil.
+// Sources of kept files are read from paths resolved by path for formats with byte offsets.
+func loadProfiles(covFiles string, keep func(fn string) bool, path func(fn string) string) (*profileSet, error) {
+	fileNames, err := expandProfiles(covFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := &profileSet{
+		blocks: map[string][]*profileBlock{},
+		index:  map[blockKey]*profileBlock{},
+		keep:   keep,
+		path:   path,
+	}
+
+	for _, fileName := range fileNames {
+		var (
+			mode string
+			err  error
+		)
+
+		if isCoverDir(fileName) {
+			mode, err = parseCoverDir(fileName, ps.merge)
+		} else {
+			mode, err = parseProfiles(fileName, ps.source, ps.merge)
+		}
+
+		if err == nil {
+			err = ps.err
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+
+		switch {
+		case ps.mode == "" || ps.mode == modeAny:
+			ps.mode = mode
+		case mode == modeAny:
+			// Counts are merged into mode of other profiles, for example clamped to set.
+		case ps.mode != mode:
+			return nil, fmt.Errorf("%s: mode %q does not match mode %q of previous profiles", fileName, mode, ps.mode)
+		}
+	}
+
+	if ps.mode == modeAny {
+		ps.mode = "count"
+	}
+
+	return ps, nil
+}
+
+// expandProfiles resolves glob patterns in a comma separated list of profile file names.
+func expandProfiles(covFiles string) ([]string, error) {
+	var fileNames []string
+
+	for _, p := range strings.Split(covFiles, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.ContainsAny(p, "*?[") {
+			fileNames = append(fileNames, p)
+
+			continue
+		}
+
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad coverage file pattern %q: %w", p, err)
+		}
+
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no coverage files match %q", p)
+		}
+
+		fileNames = append(fileNames, matches...)
+	}
+
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no coverage files specified")
+	}
+
+	return fileNames, nil
+}
+
+// merge adds block to the set, counts of blocks at the same position are summed.
+//
+// Same blocks appear multiple times in a single profile when tests of many packages
+// cover a shared package (go test -coverpkg=./... ./...), or in different profiles
+// of the same code. Occurrences are collapsed, so that statements are only counted once.
+func (ps *profileSet) merge(fn string, block profileBlock) {
+	k := blockKey{
+		fn:        fn,
+		startLine: block.StartLine,
+		startCol:  block.StartCol,
+		endLine:   block.EndLine,
+		endCol:    block.EndCol,
+	}
+
+	if b, ok := ps.index[k]; ok {
+		if b.NumStmt != block.NumStmt && ps.err == nil {
+			ps.err = fmt.Errorf("inconsistent number of statements in %s:%d.%d,%d.%d: %d and %d",
+				fn, k.startLine, k.startCol, k.endLine, k.endCol, b.NumStmt, block.NumStmt)
+		}
+
+		b.Count += block.Count
+
+		return
+	}
+
+	if !ps.add(fn) {
+		return
+	}
+
+	b := block
+	ps.index[k] = &b
+	ps.blocks[fn] = append(ps.blocks[fn], &b)
+}
+
+// add registers source file name, it reports whether blocks of the file are kept.
+func (ps *profileSet) add(fn string) bool {
+	if _, ok := ps.blocks[fn]; !ok {
+		ps.files = append(ps.files, fn)
+		ps.blocks[fn] = nil
+	}
+
+	return ps.keep == nil || ps.keep(fn)
+}
+
+// source reads source of a profile file name for formats with byte offsets, sources of files that are not kept are not read.
+func (ps *profileSet) source(fn string) []byte {
+	if !ps.add(fn) {
+		return nil
+	}
+
+	if ps.path == nil {
+		return readSource(fn, fn)
+	}
+
+	return readSource(fn, ps.path(fn))
+}
+
+// each calls a function for every merged block in order of first appearance.
+//
+// In "set" mode summed counts are reduced back to 0 or 1, which is equivalent to OR of merged blocks.
+func (ps *profileSet) each(cb func(fn string, block profileBlock)) {
+	for _, fn := range ps.files {
+		for _, b := range ps.blocks[fn] {
+			block := *b
+
+			if ps.mode == "set" && block.Count > 0 {
+				block.Count = 1
+			}
+
+			cb(fn, block)
+		}
+	}
+}
+
 // parseProfiles parses profile data in the specified file and calls a
 // function for each Profile for each source file described therein.
-// See https://github.com/golang/go/blob/0104a31b8fbcbe52728a08867b26415d282c35d2/src/cmd/cover/profile.go.
-func parseProfiles(fileName string, cb func(fn string, block profileBlock)) error {
-	pf, err := os.Open(fileName)
+// Format of the profile is detected from its content, see profileReaders.
+// Sources of profile file names are read with src by formats with byte offsets.
+// It returns the mode of the profile.
+func parseProfiles(fileName string, src sourceReader, cb func(fn string, block profileBlock)) (string, error) {
+	pf, err := openProfile(fileName)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	defer func() {
@@ -35,11 +230,28 @@ func parseProfiles(fileName string, cb func(fn string, block profileBlock)) erro
 	}()
 
 	buf := bufio.NewReader(pf)
+
+	head, err := buf.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	read, err := detectFormat(head)
+	if err != nil {
+		return "", err
+	}
+
+	return read(buf, src, cb)
+}
+
+// parseGoProfile parses profile data in Go text format.
+// See https://github.com/golang/go/blob/0104a31b8fbcbe52728a08867b26415d282c35d2/src/cmd/cover/profile.go.
+func parseGoProfile(r io.Reader, _ sourceReader, cb func(fn string, block profileBlock)) (string, error) {
 	// First line is "mode: foo", where foo is "set", "count", or "atomic".
 	// Rest of file is in the format
 	//	encoding/base64/base64.go:34.44,37.40 3 1
 	// where the fields are: name.go:line.column,line.column numberOfStatements count
-	s := bufio.NewScanner(buf)
+	s := bufio.NewScanner(r)
 	mode := ""
 
 	for s.Scan() {
@@ -49,7 +261,7 @@ func parseProfiles(fileName string, cb func(fn string, block profileBlock)) erro
 			const p = "mode: "
 
 			if !strings.HasPrefix(line, p) || line == p {
-				return fmt.Errorf("bad mode line: %v", line)
+				return "", fmt.Errorf("bad mode line: %v", line)
 			}
 
 			mode = line[len(p):]
@@ -59,7 +271,7 @@ func parseProfiles(fileName string, cb func(fn string, block profileBlock)) erro
 
 		m := lineRe.FindStringSubmatch(line)
 		if m == nil {
-			return fmt.Errorf("line %q doesn't match expected format: %v", m, lineRe)
+			return "", fmt.Errorf("line %q doesn't match expected format: %v", line, lineRe)
 		}
 
 		fn := m[1]
@@ -76,7 +288,7 @@ func parseProfiles(fileName string, cb func(fn string, block profileBlock)) erro
 		cb(fn, pb)
 	}
 
-	return s.Err()
+	return mode, s.Err()
 }
 
 func toInt(s string) int {
@@ -87,3 +299,69 @@ func toInt(s string) int {
 
 	return i
 }
+
+// openProfile opens profile file, or stdin for "-", gzip and zstd compressed data is decompressed.
+func openProfile(fileName string) (io.ReadCloser, error) {
+	var f io.ReadCloser = io.NopCloser(os.Stdin)
+
+	if fileName != "-" {
+		of, err := os.Open(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		f = of
+	}
+
+	buf := bufio.NewReader(f)
+
+	// Compression is detected by magic bytes of data.
+	magic, err := buf.Peek(4)
+	if err != nil && !errors.Is(err, io.EOF) {
+		_ = f.Close()
+
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(buf)
+		if err != nil {
+			_ = f.Close()
+
+			return nil, fmt.Errorf("failed to init gzip reader: %w", err)
+		}
+
+		return readCloser{Reader: zr, close: f.Close}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(buf, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			_ = f.Close()
+
+			return nil, fmt.Errorf("failed to init zstd reader: %w", err)
+		}
+
+		return readCloser{Reader: zr, close: func() error {
+			zr.Close()
+
+			return f.Close()
+		}}, nil
+	default:
+		return readCloser{Reader: buf, close: f.Close}, nil
+	}
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// readCloser reads from a wrapping reader and closes underlying file.
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
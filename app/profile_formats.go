@@ -0,0 +1,308 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// profileReader parses coverage data and calls a function for each block, it returns the mode of the data.
+// Sources of profile file names are only read by formats with byte offsets.
+type profileReader func(r io.Reader, src sourceReader, cb func(fn string, block profileBlock)) (string, error)
+
+// sourceReader returns source of a profile file name, nil source means statements of the file are skipped.
+type sourceReader func(fn string) []byte
+
+// readSource reads source file, it returns nil and reports an error if file is not available.
+func readSource(fn, filePath string) []byte {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		log.Printf("statements of %s are skipped, source is not available: %v", fn, err)
+
+		return nil
+	}
+
+	return content
+}
+
+// profileFormat is a coverage data format recognized by the beginning of data.
+type profileFormat struct {
+	name   string
+	detect func(head []byte) bool
+	read   profileReader
+}
+
+// profileFormats are readers of supported coverage formats, they are tried in order.
+var profileFormats = []profileFormat{
+	{name: "Go", detect: hasPrefix("mode:"), read: parseGoProfile},
+	{name: "LCOV", detect: hasPrefix("TN:", "SF:"), read: parseLCOV},
+	{name: "Cobertura", detect: hasPrefix("<"), read: parseCobertura},
+	{name: "gocov JSON", detect: hasPrefix("{"), read: parseGocov},
+}
+
+// hasPrefix returns a check of data beginning with any of prefixes.
+func hasPrefix(prefixes ...string) func(head []byte) bool {
+	return func(head []byte) bool {
+		for _, p := range prefixes {
+			if bytes.HasPrefix(head, []byte(p)) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// modeAny is a mode of formats with execution counts, such profiles are merged into profiles of any mode.
+// Mode of merged profiles is "count" if all of them have this mode.
+const modeAny = "any"
+
+// detectFormat returns a reader for the format of coverage data by its beginning.
+func detectFormat(head []byte) (profileReader, error) {
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+
+	if len(head) == 0 {
+		return nil, errors.New("empty coverage profile")
+	}
+
+	names := make([]string, 0, len(profileFormats))
+
+	for _, f := range profileFormats {
+		if f.detect(head) {
+			return f.read, nil
+		}
+
+		names = append(names, f.name)
+	}
+
+	expected := names[len(names)-1]
+	if len(names) > 1 {
+		expected = strings.Join(names[:len(names)-1], ", ") + " or " + expected
+	}
+
+	return nil, fmt.Errorf("unknown coverage profile format, expected %s", expected)
+}
+
+// lineBlock returns a block of a single line for line based formats.
+func lineBlock(line, hits int) profileBlock {
+	return profileBlock{StartLine: line, EndLine: line, NumStmt: 1, Count: hits}
+}
+
+// parseLCOV parses LCOV tracefile, for example produced by "bazel coverage" with rules_go.
+// See https://github.com/linux-test-project/lcov/blob/master/man/geninfo.1 for format description.
+func parseLCOV(r io.Reader, _ sourceReader, cb func(fn string, block profileBlock)) (string, error) {
+	s := bufio.NewScanner(r)
+	fn := ""
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case strings.HasPrefix(line, "SF:"):
+			fn = strings.TrimPrefix(line, "SF:")
+		case line == "end_of_record":
+			fn = ""
+		case strings.HasPrefix(line, "DA:"):
+			// DA:<line number>,<execution count>[,<checksum>]
+			f := strings.Split(strings.TrimPrefix(line, "DA:"), ",")
+			if fn == "" || len(f) < 2 {
+				return "", fmt.Errorf("unexpected LCOV record %q", line)
+			}
+
+			l, err := strconv.Atoi(f[0])
+			if err != nil {
+				return "", fmt.Errorf("bad line number in LCOV record %q: %w", line, err)
+			}
+
+			hits, err := strconv.ParseFloat(f[1], 64)
+			if err != nil {
+				return "", fmt.Errorf("bad execution count in LCOV record %q: %w", line, err)
+			}
+
+			cb(fn, lineBlock(l, int(hits)))
+		}
+	}
+
+	return modeAny, s.Err()
+}
+
+// parseCobertura parses Cobertura XML report, for example produced by gocover-cobertura.
+// Lines of classes are used, file names are taken from filename attributes as is.
+func parseCobertura(r io.Reader, _ sourceReader, cb func(fn string, block profileBlock)) (string, error) {
+	d := xml.NewDecoder(r)
+
+	var (
+		path []string
+		fn   string
+	)
+
+	for {
+		tok, err := d.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return "", fmt.Errorf("failed to parse Cobertura XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			path = append(path, t.Name.Local)
+
+			switch {
+			case t.Name.Local == "class":
+				fn = xmlAttr(t, "filename")
+			// Lines of methods repeat lines of classes.
+			case t.Name.Local == "line" && len(path) >= 3 && path[len(path)-2] == "lines" && path[len(path)-3] == "class":
+				l, err := strconv.Atoi(xmlAttr(t, "number"))
+				if err != nil {
+					return "", fmt.Errorf("bad line number in Cobertura XML: %w", err)
+				}
+
+				hits, err := strconv.ParseFloat(xmlAttr(t, "hits"), 64)
+				if err != nil {
+					return "", fmt.Errorf("bad hits in Cobertura XML: %w", err)
+				}
+
+				cb(fn, lineBlock(l, int(hits)))
+			}
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+
+	if fn == "" {
+		return "", errors.New("no classes found in Cobertura XML")
+	}
+
+	return modeAny, nil
+}
+
+func xmlAttr(t xml.StartElement, name string) string {
+	for _, a := range t.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+// gocovPackage is a package in gocov JSON report.
+type gocovPackage struct {
+	Name      string `json:"Name"`
+	Functions []struct {
+		File       string `json:"File"`
+		Statements []struct {
+			Start   int `json:"Start"`
+			End     int `json:"End"`
+			Reached int `json:"Reached"`
+		} `json:"Statements"`
+	} `json:"Functions"`
+}
+
+// parseGocov parses gocov JSON report, packages are decoded one by one.
+// Statements have byte offsets, so source files of the report are read with src to find lines and columns,
+// files are read by their names as is if src is nil.
+func parseGocov(r io.Reader, src sourceReader, cb func(fn string, block profileBlock)) (string, error) {
+	d := json.NewDecoder(r)
+	sources := map[string]*sourceLines{}
+
+	if src == nil {
+		src = func(fn string) []byte {
+			return readSource(fn, fn)
+		}
+	}
+
+	if err := expectDelim(d, '{'); err != nil {
+		return "", err
+	}
+
+	for d.More() {
+		key, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("failed to parse gocov JSON: %w", err)
+		}
+
+		if key != "Packages" {
+			var skip json.RawMessage
+			if err := d.Decode(&skip); err != nil {
+				return "", fmt.Errorf("failed to parse gocov JSON: %w", err)
+			}
+
+			continue
+		}
+
+		if err := expectDelim(d, '['); err != nil {
+			return "", err
+		}
+
+		for d.More() {
+			var pkg gocovPackage
+
+			if err := d.Decode(&pkg); err != nil {
+				return "", fmt.Errorf("failed to parse gocov JSON: %w", err)
+			}
+
+			for _, fu := range pkg.Functions {
+				lines, ok := sources[fu.File]
+				if !ok {
+					if content := src(fu.File); content != nil {
+						sl := newSourceLines(content)
+						lines = &sl
+					}
+
+					sources[fu.File] = lines
+				}
+
+				if lines == nil {
+					continue
+				}
+
+				for _, st := range fu.Statements {
+					startLine, startCol := lines.position(st.Start)
+					endLine, endCol := lines.position(st.End)
+
+					cb(fu.File, profileBlock{
+						StartLine: startLine,
+						StartCol:  startCol,
+						EndLine:   endLine,
+						EndCol:    endCol,
+						NumStmt:   1,
+						Count:     st.Reached,
+					})
+				}
+			}
+		}
+
+		if err := expectDelim(d, ']'); err != nil {
+			return "", err
+		}
+	}
+
+	return modeAny, nil
+}
+
+func expectDelim(d *json.Decoder, delim json.Delim) error {
+	tok, err := d.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse gocov JSON: %w", err)
+	}
+
+	if tok != delim {
+		return fmt.Errorf("failed to parse gocov JSON: unexpected %v, %v expected", tok, delim)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadProfiles(t *testing.T) {
+	ps, err := loadProfiles("_testdata/count.*.txt", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "count", ps.mode)
+
+	var blocks []profileBlock
+
+	ps.each(func(fn string, block profileBlock) {
+		assert.Equal(t, "sample/bar.go", fn)
+
+		blocks = append(blocks, block)
+	})
+
+	assert.Equal(t, []profileBlock{
+		{StartLine: 3, StartCol: 22, EndLine: 4, EndCol: 11, NumStmt: 1, Count: 5},
+		{StartLine: 4, StartCol: 11, EndLine: 6, EndCol: 3, NumStmt: 1, Count: 1},
+		{StartLine: 8, StartCol: 2, EndLine: 8, EndCol: 12, NumStmt: 1, Count: 0},
+	}, blocks)
+}
+
+func Test_loadProfiles_modeMismatch(t *testing.T) {
+	_, err := loadProfiles("_testdata/coverage.unit.txt, _testdata/count.unit.txt", nil, nil)
+	assert.EqualError(t, err, `_testdata/count.unit.txt: mode "count" does not match mode "set" of previous profiles`)
+}
+
+func Test_loadProfiles_lineFormatMode(t *testing.T) {
+	lcov := filepath.Join(t.TempDir(), "coverage.lcov")
+	require.NoError(t, os.WriteFile(lcov, []byte("SF:sample/baz.go\nDA:3,5\nDA:4,0\nend_of_record\n"), 0o600))
+
+	// Counts of line formats are clamped to set mode of Go profile.
+	ps, err := loadProfiles(lcov+",_testdata/coverage.txt", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "set", ps.mode)
+
+	var counts []int
+
+	ps.each(func(fn string, block profileBlock) {
+		if fn == "sample/baz.go" {
+			counts = append(counts, block.Count)
+		}
+	})
+
+	assert.Equal(t, []int{1, 0}, counts)
+
+	ps, err = loadProfiles(lcov, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "count", ps.mode)
+	assert.Equal(t, 5, ps.blocks["sample/baz.go"][0].Count)
+}
+
+func Test_loadProfiles_noMatch(t *testing.T) {
+	_, err := loadProfiles("_testdata/missing.*.txt", nil, nil)
+	assert.EqualError(t, err, `no coverage files match "_testdata/missing.*.txt"`)
+}
+
+func Test_loadProfiles_coverDir(t *testing.T) {
+	ps, err := loadProfiles("_testdata/covdata,_testdata/covdata", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "count", ps.mode)
+
+	res := ""
+
+	ps.each(func(fn string, block profileBlock) {
+		res += fmt.Sprintf("%s:%d.%d,%d.%d %d %d\n", fn,
+			block.StartLine, block.StartCol, block.EndLine, block.EndCol, block.NumStmt, block.Count)
+	})
+
+	// Counters are doubled since the same directory is merged twice.
+	assert.Equal(t, `sample/bar.go:4.2,4.11 1 4
+sample/bar.go:8.2,8.12 1 2
+sample/bar.go:12.2,12.12 1 2
+sample/bar.go:16.2,16.14 1 0
+sample/bar.go:5.3,6.1 1 2
+sample/bar.go:9.3,10.1 1 0
+sample/bar.go:13.3,14.1 1 2
+sample/foo.go:6.2,6.12 1 2
+sample/foo.go:10.2,10.11 1 2
+sample/foo.go:14.2,14.12 1 2
+sample/foo.go:18.2,18.12 1 0
+sample/foo.go:22.2,22.14 1 0
+sample/foo.go:7.3,8.1 1 0
+sample/foo.go:11.3,12.1 1 0
+sample/foo.go:15.3,16.1 1 2
+sample/foo.go:19.3,20.1 1 0
+`, res)
+}
+
+func Test_loadProfiles_inconsistent(t *testing.T) {
+	_, err := loadProfiles("_testdata/inconsistent.count.txt", nil, nil)
+	assert.EqualError(t, err, "_testdata/inconsistent.count.txt: inconsistent number of statements in sample/bar.go:3.22,4.11: 1 and 2")
+}
+
+func Test_loadProfiles_compressed(t *testing.T) {
+	expected, err := loadProfiles("_testdata/coverage.count.txt", nil, nil)
+	require.NoError(t, err)
+
+	for _, fn := range []string{"_testdata/coverage.count.txt.gz", "_testdata/coverage.count.txt.zst"} {
+		ps, err := loadProfiles(fn, nil, nil)
+		require.NoError(t, err, fn)
+		assert.Equal(t, expected, ps, fn)
+	}
+}
+
+func Test_loadProfiles_stdin(t *testing.T) {
+	f, err := os.Open("_testdata/coverage.count.txt.gz")
+	require.NoError(t, err)
+
+	stdin := os.Stdin
+	os.Stdin = f
+
+	defer func() {
+		os.Stdin = stdin
+
+		require.NoError(t, f.Close())
+	}()
+
+	ps, err := loadProfiles("-", func(fn string) bool {
+		return fn == "sample/foo.go"
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "count", ps.mode)
+	assert.Equal(t, []string{"sample/bar.go", "sample/foo.go"}, ps.files)
+	assert.Empty(t, ps.blocks["sample/bar.go"])
+	assert.Len(t, ps.blocks["sample/foo.go"], 9)
+}
+
+func Test_loadProfiles_formats(t *testing.T) {
+	for _, tc := range []struct {
+		fileName string
+		fn       string
+		first    profileBlock
+		blocks   int
+	}{
+		{
+			fileName: "_testdata/coverage.lcov",
+			fn:       "sample/bar.go",
+			first:    profileBlock{StartLine: 3, EndLine: 3, NumStmt: 1, Count: 1},
+			blocks:   25,
+		},
+		{
+			fileName: "_testdata/coverage.cobertura.xml",
+			fn:       "sample/bar.go",
+			first:    profileBlock{StartLine: 3, EndLine: 3, NumStmt: 1, Count: 1},
+			blocks:   25,
+		},
+		{
+			fileName: "_testdata/coverage.gocov.json",
+			fn:       "bar.go",
+			first:    profileBlock{StartLine: 3, StartCol: 22, EndLine: 4, EndCol: 11, NumStmt: 1, Count: 1},
+			blocks:   16,
+		},
+	} {
+		t.Run(tc.fileName, func(t *testing.T) {
+			if tc.fn == "bar.go" {
+				require.NoError(t, os.Chdir("_testdata"))
+
+				defer func() {
+					require.NoError(t, os.Chdir(".."))
+				}()
+
+				tc.fileName = tc.fileName[len("_testdata/"):]
+			}
+
+			ps, err := loadProfiles(tc.fileName, nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "count", ps.mode)
+			assert.Equal(t, tc.fn, ps.files[0])
+			assert.Equal(t, tc.first, *ps.blocks[tc.fn][0])
+
+			cnt := 0
+
+			ps.each(func(fn string, block profileBlock) {
+				cnt++
+			})
+
+			assert.Equal(t, tc.blocks, cnt)
+		})
+	}
+}
+
+func Test_detectFormat(t *testing.T) {
+	_, err := detectFormat([]byte("   "))
+	assert.EqualError(t, err, "empty coverage profile")
+
+	_, err = detectFormat([]byte("foo"))
+	assert.EqualError(t, err, "unknown coverage profile format, expected Go, LCOV, Cobertura or gocov JSON")
+}
+
+func Test_loadProfiles_gocovSources(t *testing.T) {
+	var read []string
+
+	ps, err := loadProfiles("_testdata/coverage.gocov.json", func(fn string) bool {
+		return fn == "bar.go"
+	}, func(fn string) string {
+		read = append(read, fn)
+
+		return filepath.Join("_testdata", fn)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bar.go"}, read)
+	assert.Equal(t, []string{"bar.go", "foo.go"}, ps.files)
+	assert.Len(t, ps.blocks["bar.go"], 7)
+	assert.Empty(t, ps.blocks["foo.go"])
+
+	// Statements of files with missing sources are skipped.
+	ps, err = loadProfiles("_testdata/coverage.gocov.json", nil, func(fn string) string {
+		return filepath.Join("_testdata", "missing", fn)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bar.go", "foo.go"}, ps.files)
+	assert.Empty(t, ps.blocks["bar.go"])
+	assert.Empty(t, ps.blocks["foo.go"])
+}
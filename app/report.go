@@ -5,12 +5,45 @@ import (
 	"io"
 	"log"
 	"sort"
+	"strconv"
 
 	"github.com/olekukonko/tablewriter"
 )
 
-func printReport(w io.Writer, covStmt, totStmt int, functions []stat, fileCoverage map[string]stat, untestedFiles []string) {
-	if totStmt == 0 {
+// coverageReport is a summary of changed lines coverage.
+type coverageReport struct {
+	covStmt, totStmt int
+	total            stat
+	functions        []stat
+	fileCoverage     map[string]stat
+	untestedFiles    []string
+	notBuiltFiles    []string
+	staleFiles       []string
+	diagnostics      []string
+	moved            []string
+	deletedFuncs     []string
+	generated        []string
+
+	// countMode enables execution counts in the report.
+	countMode bool
+	// minHits enables reporting of weakly covered statements.
+	minHits int
+}
+
+func printReport(w io.Writer, r coverageReport) {
+	printTable(w, r)
+
+	printSection(w, "Generated files skipped, use -include-generated to count them:", r.generated)
+	printSection(w, "Functions modified by deletion only, with current coverage:", r.deletedFuncs)
+	printSection(w, "Moved code, not counted as changed:", r.moved)
+	printSection(w, "Coverage profile does not match current sources, it may be stale:", r.staleFiles)
+	printSection(w, "Not built in this configuration, check -goos, -goarch and -tags:", r.notBuiltFiles)
+	printSection(w, "Possible path mismatch between coverage profile and changed files:", r.diagnostics)
+}
+
+// printTable prints coverage of changed statements by modules, files and functions.
+func printTable(w io.Writer, r coverageReport) {
+	if r.totStmt == 0 {
 		_, err := w.Write([]byte("No changes in testable statements.\n"))
 		if err != nil {
 			log.Fatal("failed to write report: ", err)
@@ -19,10 +52,29 @@ func printReport(w io.Writer, covStmt, totStmt int, functions []stat, fileCovera
 		return
 	}
 
+	functions := r.functions
+	moduleCoverage := map[string]stat{}
+
+	for _, fc := range r.fileCoverage {
+		mc := moduleCoverage[fc.module]
+		mc.add(fc)
+		moduleCoverage[fc.module] = mc
+	}
+
+	// Module sections are only needed when changes span multiple modules.
+	modules := map[string]bool{}
+	for _, fu := range functions {
+		modules[fu.module] = true
+	}
+
 	sort.Slice(functions, func(i, j int) bool {
 		fi := functions[i]
 		fj := functions[j]
 
+		if fi.module != fj.module {
+			return fi.module < fj.module
+		}
+
 		if fi.file != fj.file {
 			return fi.file < fj.file
 		}
@@ -35,30 +87,95 @@ func printReport(w io.Writer, covStmt, totStmt int, functions []stat, fileCovera
 	})
 
 	data := make([][]string, 0, len(functions))
-	data = append(data, []string{"Total", "", fmt.Sprintf("%.1f%%", float64(covStmt)/float64(totStmt)*100)})
+	data = append(data, r.row([]string{"Total", "", fmt.Sprintf("%.1f%%", float64(r.covStmt)/float64(r.totStmt)*100)}, r.total))
 
 	prevFile := ""
-	for _, fu := range functions {
+	prevModule := ""
+
+	for i, fu := range functions {
+		if len(modules) > 1 && (i == 0 || fu.module != prevModule) {
+			mc := moduleCoverage[fu.module]
+
+			data = append(data, r.row([]string{"module " + fu.module, "", fmt.Sprintf("%.1f%%", float64(mc.covStmt*100)/float64(mc.totStmt))}, mc))
+		}
+
 		if fu.file != prevFile {
-			fc := fileCoverage[fu.file]
+			fc := r.fileCoverage[fu.file]
 
-			data = append(data, []string{fu.file, "", fmt.Sprintf("%.1f%%", float64(fc.covStmt*100)/float64(fc.totStmt))})
+			data = append(data, r.row([]string{fu.file, "", fmt.Sprintf("%.1f%%", float64(fc.covStmt*100)/float64(fc.totStmt))}, fc))
 		}
 
-		data = append(data, []string{fmt.Sprintf("%s:%d", fu.file, fu.line), fu.name, fmt.Sprintf("%.1f%%", fu.covPercent)})
+		data = append(data, r.row([]string{fmt.Sprintf("%s:%d", fu.file, fu.line), fu.name, fmt.Sprintf("%.1f%%", fu.covPercent)}, fu))
 		prevFile = fu.file
+		prevModule = fu.module
 	}
 
-	for _, fn := range untestedFiles {
-		data = append(data, []string{fn, "", "no coverage"})
+	for _, fn := range r.untestedFiles {
+		data = append(data, r.row([]string{fn, "", "no coverage"}, stat{}))
 	}
 
 	table := tablewriter.NewWriter(w)
 	table.SetAutoFormatHeaders(false)
-	table.SetHeader([]string{"File", "Function", "Coverage"})
+	table.SetHeader(r.header())
 	table.SetAlignment(tablewriter.ALIGN_LEFT)
 	table.SetBorders(tablewriter.Border{Left: true, Top: false, Right: true, Bottom: false})
 	table.SetCenterSeparator("|")
 	table.AppendBulk(data) // Add Bulk Data
 	table.Render()
 }
+
+func (r coverageReport) header() []string {
+	h := []string{"File", "Function", "Coverage"}
+
+	if r.countMode {
+		h = append(h, "Hits")
+
+		if r.minHits > 0 {
+			h = append(h, fmt.Sprintf("Weak (<%d)", r.minHits))
+		}
+	}
+
+	return h
+}
+
+// row appends execution counts of changed statements in count mode.
+func (r coverageReport) row(cols []string, s stat) []string {
+	if !r.countMode {
+		return cols
+	}
+
+	hits, weak := "", ""
+
+	if s.hasHits {
+		hits = strconv.Itoa(s.minHits)
+		weak = strconv.Itoa(s.weakStmt)
+
+		if s.minHits != s.maxHits {
+			hits = fmt.Sprintf("%d-%d", s.minHits, s.maxHits)
+		}
+	}
+
+	cols = append(cols, hits)
+
+	if r.minHits > 0 {
+		cols = append(cols, weak)
+	}
+
+	return cols
+}
+
+// printSection lists items after the report under a title, nothing is printed without items.
+func printSection(w io.Writer, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+
+	res := "\n" + title + "\n"
+	for _, item := range items {
+		res += "- " + item + "\n"
+	}
+
+	if _, err := w.Write([]byte(res)); err != nil {
+		log.Fatal("failed to write report: ", err)
+	}
+}
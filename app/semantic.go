@@ -0,0 +1,407 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+// formattingOnlyLines returns added lines of file whose statements have equal tokens in old and new versions,
+// so they are only changed by formatting or comments.
+//
+// Old version is restored by reverse applying hunks to the file. Declarations of old and new versions are matched
+// by tokens, then statements of each block of matched functions and statements are aligned in order. Tokens of
+// statements exclude bodies of nested blocks, so each line belongs to the innermost statement or declaration.
+func formattingOnlyLines(fileName string, fd *fileDiff) (map[int]bool, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	oldContent, err := reverseApply(content, fd.hunks)
+	if err != nil {
+		return nil, err
+	}
+
+	added := map[int]bool{}
+
+	for _, h := range fd.hunks {
+		for _, l := range h.lines {
+			if l.kind == lineAdded {
+				added[l.newNum] = true
+			}
+		}
+	}
+
+	newSrc, err := parseSource(fileName, content)
+	if err != nil {
+		return nil, err
+	}
+
+	oldSrc, err := parseSource(fileName, oldContent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse old version: %w", err)
+	}
+
+	sd := semanticDiff{old: oldSrc, new: newSrc, added: added, unchanged: map[int]bool{}}
+	sd.decls()
+
+	res := map[int]bool{}
+
+	for line := range added {
+		// Lines without statements or declarations are blank lines and comments.
+		if unchanged, ok := sd.unchanged[line]; !ok || unchanged {
+			res[line] = true
+		}
+	}
+
+	return res, nil
+}
+
+// reverseApply restores old version of content by hunks of diff.
+func reverseApply(content []byte, hunks []*diffHunk) ([]byte, error) {
+	newLines := strings.SplitAfter(string(content), "\n")
+	if newLines[len(newLines)-1] == "" {
+		newLines = newLines[:len(newLines)-1]
+	}
+
+	var (
+		old strings.Builder
+		cur = 1 // Next line of new version.
+	)
+
+	for _, h := range hunks {
+		start := h.newStart
+		if h.newLines == 0 {
+			start++ // Empty range starts after the line.
+		}
+
+		if start-1 > len(newLines) || start < cur {
+			return nil, fmt.Errorf("hunk %s does not match file", h.header())
+		}
+
+		for ; cur < start; cur++ {
+			old.WriteString(newLines[cur-1])
+		}
+
+		for _, l := range h.lines {
+			if l.kind == lineRemoved {
+				old.WriteString(l.content)
+				old.WriteString("\n")
+
+				continue
+			}
+
+			if cur > len(newLines) || strings.TrimSuffix(newLines[cur-1], "\n") != l.content {
+				return nil, fmt.Errorf("line %d does not match hunk %s", cur, h.header())
+			}
+
+			if l.kind == lineContext {
+				old.WriteString(newLines[cur-1])
+			}
+
+			cur++
+		}
+	}
+
+	for ; cur <= len(newLines); cur++ {
+		old.WriteString(newLines[cur-1])
+	}
+
+	return []byte(old.String()), nil
+}
+
+// srcToken is a token of source without comments.
+type srcToken struct {
+	offset int
+	text   string
+}
+
+// parsedSource is a parsed file with tokens of its source.
+type parsedSource struct {
+	file   *ast.File
+	tf     *token.File
+	tokens []srcToken
+}
+
+func parseSource(fileName string, content []byte) (parsedSource, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, fileName, content, 0)
+	if err != nil {
+		return parsedSource{}, err
+	}
+
+	tokens, err := scanTokens(content)
+	if err != nil {
+		return parsedSource{}, err
+	}
+
+	return parsedSource{file: f, tf: fset.File(f.Pos()), tokens: tokens}, nil
+}
+
+func (ps parsedSource) form(n ast.Node) string {
+	return nodeForm(ps.tf, ps.tokens, n)
+}
+
+// semanticDiff aligns declarations and statements of old and new versions.
+type semanticDiff struct {
+	old, new parsedSource
+	added    map[int]bool
+
+	// unchanged tells if the innermost node of an added line has a match in old version.
+	unchanged map[int]bool
+}
+
+// decls matches declarations by tokens regardless of order, as order of declarations does not change behavior.
+func (sd semanticDiff) decls() {
+	oldDecls := map[string][]ast.Decl{}
+
+	for _, d := range sd.old.file.Decls {
+		k := sd.old.form(d)
+		oldDecls[k] = append(oldDecls[k], d)
+	}
+
+	for _, d := range sd.new.file.Decls {
+		k := sd.new.form(d)
+		od := oldDecls[k]
+
+		sd.mark(d, len(od) > 0)
+
+		fd, ok := d.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+
+		var oldBody []ast.Stmt
+
+		if len(od) > 0 {
+			if ofd, ok := od[0].(*ast.FuncDecl); ok && ofd.Body != nil {
+				oldBody = ofd.Body.List
+			}
+
+			oldDecls[k] = od[1:]
+		}
+
+		sd.stmts(oldBody, fd.Body.List)
+	}
+}
+
+// stmts aligns statements of a block by the longest common subsequence of their tokens,
+// nested blocks of aligned statements are aligned recursively.
+func (sd semanticDiff) stmts(oldList, newList []ast.Stmt) {
+	oldForms := make([]string, len(oldList))
+	for i, s := range oldList {
+		oldForms[i] = sd.old.form(s)
+	}
+
+	newForms := make([]string, len(newList))
+	for i, s := range newList {
+		newForms[i] = sd.new.form(s)
+	}
+
+	pairs := commonPairs(oldForms, newForms)
+
+	for j, s := range newList {
+		i, ok := pairs[j]
+
+		sd.mark(s, ok)
+
+		newBlocks := childBlocks(s)
+
+		var oldBlocks [][]ast.Stmt
+		if ok {
+			oldBlocks = childBlocks(oldList[i])
+		}
+
+		for k, b := range newBlocks {
+			var ob []ast.Stmt
+			if len(oldBlocks) == len(newBlocks) {
+				ob = oldBlocks[k]
+			}
+
+			sd.stmts(ob, b)
+		}
+	}
+}
+
+// mark sets status of added lines of node, nodes are marked from outer to inner, so the innermost node is the last one.
+func (sd semanticDiff) mark(n ast.Node, unchanged bool) {
+	for l := sd.new.tf.Line(n.Pos()); l <= sd.new.tf.Line(n.End()); l++ {
+		if sd.added[l] {
+			sd.unchanged[l] = unchanged
+		}
+	}
+}
+
+// childBlocks returns statements of blocks nested in statement, including bodies of function literals.
+func childBlocks(s ast.Stmt) [][]ast.Stmt {
+	switch s := s.(type) {
+	case *ast.CaseClause:
+		return [][]ast.Stmt{s.Body}
+	case *ast.CommClause:
+		return [][]ast.Stmt{s.Body}
+	}
+
+	var blocks [][]ast.Stmt
+
+	ast.Inspect(s, func(n ast.Node) bool {
+		if b, ok := n.(*ast.BlockStmt); ok && n != s {
+			blocks = append(blocks, b.List)
+
+			return false
+		}
+
+		return true
+	})
+
+	return blocks
+}
+
+// commonPairs returns indexes of a elements by indexes of equal b elements in their longest common subsequence.
+func commonPairs(a, b []string) map[int]int {
+	// lcs[i][j] is a length of common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	pairs := map[int]int{}
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			pairs[j] = i
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	return pairs
+}
+
+// scanTokens returns tokens of source without comments and automatic semicolons.
+func scanTokens(content []byte) ([]srcToken, error) {
+	var (
+		s      scanner.Scanner
+		errs   scanner.ErrorList
+		tokens []srcToken
+	)
+
+	fset := token.NewFileSet()
+	tf := fset.AddFile("", fset.Base(), len(content))
+	s.Init(tf, content, func(pos token.Position, msg string) { errs.Add(pos, msg) }, 0)
+
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+
+		text := tok.String()
+		if lit != "" {
+			text = lit
+		}
+
+		tokens = append(tokens, srcToken{offset: tf.Offset(pos), text: text})
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.New(errs.Error())
+	}
+
+	return tokens, nil
+}
+
+// nodeForm returns tokens of node, bodies of nested blocks and clauses are replaced with braces.
+func nodeForm(tf *token.File, tokens []srcToken, n ast.Node) string {
+	type span struct{ start, end int }
+
+	var skip []span
+
+	skipBody := func(start, end token.Pos) {
+		if start < end {
+			skip = append(skip, span{tf.Offset(start), tf.Offset(end)})
+		}
+	}
+
+	ast.Inspect(n, func(c ast.Node) bool {
+		switch c := c.(type) {
+		case *ast.BlockStmt:
+			skipBody(c.Lbrace+1, c.Rbrace)
+
+			return false
+		case *ast.CaseClause:
+			skipBody(c.Colon+1, c.End())
+
+			return c == n
+		case *ast.CommClause:
+			skipBody(c.Colon+1, c.End())
+
+			return c == n
+		}
+
+		return true
+	})
+
+	start, end := tf.Offset(n.Pos()), tf.Offset(n.End())
+
+	var b strings.Builder
+
+tokenLoop:
+	for i := sort.Search(len(tokens), func(i int) bool { return tokens[i].offset >= start }); i < len(tokens); i++ {
+		t := tokens[i]
+		if t.offset >= end {
+			break
+		}
+
+		for _, s := range skip {
+			if t.offset >= s.start && t.offset < s.end {
+				continue tokenLoop
+			}
+		}
+
+		// Trailing commas are added when lists are wrapped.
+		if t.text == "," && i+1 < len(tokens) {
+			switch tokens[i+1].text {
+			case ")", "}", "]":
+				continue
+			}
+		}
+
+		if b.Len() > 0 {
+			b.WriteString(" ")
+		}
+
+		b.WriteString(t.text)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_formattingOnlyLines(t *testing.T) {
+	// Only the condition and the added statement are changed.
+	assert.Equal(t, []int{21, 33}, semanticChanges(t, "diff.txt", "sem.go"))
+
+	// Reordered and un-nested statements are changed.
+	assert.Equal(t, []int{7, 14}, semanticChanges(t, "reorder.diff", "reorder.go"))
+}
+
+// semanticChanges returns added lines of a fixture that are not formatting-only.
+func semanticChanges(t *testing.T, diffFile, fileName string) []int {
+	t.Helper()
+
+	f, err := os.Open("_testdata/semantic/" + diffFile)
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+
+	d, err := parseDiff(f)
+	require.NoError(t, err)
+
+	unchanged, err := formattingOnlyLines("_testdata/semantic/"+fileName, d.files[0])
+	require.NoError(t, err)
+
+	var changed []int
+
+	for _, h := range d.files[0].hunks {
+		for _, l := range h.lines {
+			if l.kind == lineAdded && !unchanged[l.newNum] {
+				changed = append(changed, l.newNum)
+			}
+		}
+	}
+
+	sort.Ints(changed)
+
+	return changed
+}
+
+func Test_reverseApply(t *testing.T) {
+	f, err := os.Open("_testdata/semantic/diff.txt")
+	require.NoError(t, err)
+
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+
+	d, err := parseDiff(f)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile("_testdata/semantic/sem.go")
+	require.NoError(t, err)
+
+	old, err := reverseApply(content, d.files[0].hunks)
+	require.NoError(t, err)
+	assert.Contains(t, string(old), "\tif a > 0 {\n")
+	assert.Contains(t, string(old), "\t\t\ts += i\n\t}\n\treturn s\n}\n")
+	assert.NotContains(t, string(old), "Plain sum")
+
+	_, err = reverseApply([]byte("package sem\n"), d.files[0].hunks)
+	assert.Error(t, err)
+}
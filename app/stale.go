@@ -0,0 +1,140 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"sort"
+)
+
+// countStaleBlocks counts profile blocks that do not match statements of current source file.
+//
+// A valid block is within a block of current source and starts and ends on its boundaries,
+// or on line boundaries as blocks may be split at blank and comment lines.
+func countStaleBlocks(fileName string, blocks []profileBlock) (int, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	expected, err := findBlocks(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	src := newSourceLines(content)
+	cnt := 0
+
+	for _, b := range blocks {
+		if !src.matchesBlock(b, expected) {
+			cnt++
+		}
+	}
+
+	return cnt, nil
+}
+
+// sourceLines locates positions of profile blocks in source.
+type sourceLines struct {
+	content    []byte
+	lineStarts []int
+}
+
+func newSourceLines(content []byte) sourceLines {
+	s := sourceLines{content: content, lineStarts: []int{0}}
+
+	for i, c := range content {
+		if c == '\n' {
+			s.lineStarts = append(s.lineStarts, i+1)
+		}
+	}
+
+	return s
+}
+
+// offset returns byte offset of 1-based line and column, or -1 if the position does not exist.
+func (s sourceLines) offset(line, col int) int {
+	if line < 1 || line > len(s.lineStarts) || col < 1 {
+		return -1
+	}
+
+	lineEnd := len(s.content)
+	if line < len(s.lineStarts) {
+		lineEnd = s.lineStarts[line] - 1
+	}
+
+	off := s.lineStarts[line-1] + col - 1
+	if off > lineEnd {
+		return -1
+	}
+
+	return off
+}
+
+// position returns 1-based line and column of byte offset.
+func (s sourceLines) position(offset int) (line, col int) {
+	line = sort.Search(len(s.lineStarts), func(i int) bool {
+		return s.lineStarts[i] > offset
+	})
+	if line == 0 {
+		return 0, 0
+	}
+
+	return line, offset - s.lineStarts[line-1] + 1
+}
+
+// matchesBlock checks if profile block is aligned with one of expected blocks.
+func (s sourceLines) matchesBlock(b profileBlock, expected []profileBlock) bool {
+	// Blocks of line based formats only need existing lines.
+	if b.StartCol == 0 {
+		return b.StartLine >= 1 && b.EndLine <= len(s.lineStarts) && b.StartLine <= b.EndLine
+	}
+
+	start := s.offset(b.StartLine, b.StartCol)
+	end := s.offset(b.EndLine, b.EndCol)
+
+	if start < 0 || end < 0 || end < start {
+		return false
+	}
+
+	for _, e := range expected {
+		eStart := s.offset(e.StartLine, e.StartCol)
+		eEnd := s.offset(e.EndLine, e.EndCol)
+
+		if start < eStart || end > eEnd {
+			continue
+		}
+
+		startOK := isFiller(s.content[eStart:start]) || isFiller(s.content[s.lineStarts[b.StartLine-1]:start])
+		endOK := isFiller(s.content[end:eEnd]) || b.EndCol == 1
+
+		if startOK && endOK {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFiller checks if source contains only spaces, braces and comments.
+func isFiller(src []byte) bool {
+	for i := 0; i < len(src); i++ {
+		switch {
+		case bytes.ContainsRune([]byte(" \t\r\n{}"), rune(src[i])):
+		case bytes.HasPrefix(src[i:], []byte("//")):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case bytes.HasPrefix(src[i:], []byte("/*")):
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				return false
+			}
+
+			i += end + 3
+		default:
+			return false
+		}
+	}
+
+	return true
+}
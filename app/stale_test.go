@@ -0,0 +1,30 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_countStaleBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		block profileBlock
+		stale bool
+	}{
+		{name: "exact", block: profileBlock{StartLine: 5, StartCol: 22, EndLine: 6, EndCol: 12, NumStmt: 1}},
+		{name: "first token", block: profileBlock{StartLine: 6, StartCol: 13, EndLine: 8, EndCol: 3, NumStmt: 1}},
+		{name: "split at line", block: profileBlock{StartLine: 5, StartCol: 22, EndLine: 6, EndCol: 1, NumStmt: 1}},
+		{name: "missing line", block: profileBlock{StartLine: 50, StartCol: 1, EndLine: 51, EndCol: 1, NumStmt: 1}, stale: true},
+		{name: "missing column", block: profileBlock{StartLine: 3, StartCol: 22, EndLine: 4, EndCol: 11, NumStmt: 1}, stale: true},
+		{name: "not a statement", block: profileBlock{StartLine: 10, StartCol: 5, EndLine: 10, EndCol: 11, NumStmt: 1}, stale: true},
+		{name: "across blocks", block: profileBlock{StartLine: 5, StartCol: 22, EndLine: 8, EndCol: 3, NumStmt: 2}, stale: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cnt, err := countStaleBlocks("_testdata/foo.go", []profileBlock{tc.block})
+			require.NoError(t, err)
+			assert.Equal(t, tc.stale, cnt == 1)
+		})
+	}
+}
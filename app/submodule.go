@@ -0,0 +1,136 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// emptyTree is the hash of empty git tree, it is a base for diff of added submodule.
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// gitlinkMode is a file mode of submodule entries in git trees.
+const gitlinkMode = "160000"
+
+// submodulePointer returns old and new commits of submodule pointer change, false if file is not a submodule.
+// Old commit is empty for added submodule, new commit is empty for deleted submodule.
+func submodulePointer(fd *fileDiff) (oldCommit, newCommit string, ok bool) {
+	if fd.oldMode != gitlinkMode && fd.newMode != gitlinkMode {
+		return "", "", false
+	}
+
+	for _, h := range fd.hunks {
+		for _, l := range h.lines {
+			c := strings.TrimPrefix(l.content, "Subproject commit ")
+
+			switch l.kind {
+			case lineRemoved:
+				oldCommit = c
+			case lineAdded:
+				newCommit = c
+			}
+		}
+	}
+
+	return oldCommit, newCommit, true
+}
+
+// expandSubmodules replaces submodule pointer changes with diffs of checked out submodules, recursively.
+// File names of submodule diffs are prefixed with submodule path.
+func expandSubmodules(diff *unifiedDiff, root string) error {
+	files := make([]*fileDiff, 0, len(diff.files))
+
+	for _, fd := range diff.files {
+		oldCommit, newCommit, ok := submodulePointer(fd)
+		if !ok {
+			files = append(files, fd)
+
+			continue
+		}
+
+		// Deleted submodule has no added lines to analyze.
+		if newCommit == "" {
+			continue
+		}
+
+		dir := fd.newName
+		args := []string{"-C", filepath.Join(root, filepath.FromSlash(dir)), "diff", "--no-color", "--submodule=short"}
+
+		if oldCommit == "" {
+			oldCommit = emptyTree
+		}
+
+		args = append(args, oldCommit)
+
+		// Dirty submodule is compared with its working tree.
+		if !strings.HasSuffix(newCommit, "-dirty") {
+			args = append(args, newCommit)
+		}
+
+		o, err := exec.Command("git", args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to diff submodule %s, is it checked out? git %s: %w\n%s", dir, strings.Join(args, " "), err, string(o))
+		}
+
+		sub, err := parseDiff(bytes.NewReader(o))
+		if err != nil {
+			return fmt.Errorf("failed to parse diff of submodule %s: %w", dir, err)
+		}
+
+		if err := expandSubmodules(sub, filepath.Join(root, filepath.FromSlash(dir))); err != nil {
+			return err
+		}
+
+		for _, sfd := range sub.files {
+			if sfd.oldName != "" {
+				sfd.oldName = path.Join(dir, sfd.oldName)
+			}
+
+			if sfd.newName != "" {
+				sfd.newName = path.Join(dir, sfd.newName)
+			}
+
+			files = append(files, sfd)
+		}
+
+		diff.submodules = append(diff.submodules, dir)
+
+		for _, s := range sub.submodules {
+			diff.submodules = append(diff.submodules, path.Join(dir, s))
+		}
+	}
+
+	diff.files = files
+
+	return nil
+}
+
+// addSubmodule maps module of submodule directory if it is not mapped yet.
+func (m *pathMapper) addSubmodule(dir string) {
+	gm, err := os.ReadFile(filepath.Join(m.root, filepath.FromSlash(dir), "go.mod"))
+	if err != nil {
+		return
+	}
+
+	mod := parseDirectives(gm)["module"]
+	if len(mod) == 0 {
+		return
+	}
+
+	for _, mi := range m.modules {
+		if mi.path == mod[0][0] {
+			return
+		}
+	}
+
+	m.modules = append(m.modules, moduleInfo{path: mod[0][0], dir: dir})
+
+	sort.SliceStable(m.modules, func(i, j int) bool {
+		return len(m.modules[i].path) > len(m.modules[j].path)
+	})
+}
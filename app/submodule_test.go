@@ -0,0 +1,126 @@
+package app
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_expandSubmodules(t *testing.T) {
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	tmp := t.TempDir()
+
+	git := func(dir string, args ...string) {
+		args = append([]string{"-C", filepath.Join(tmp, dir), "-c", "protocol.file.allow=always",
+			"-c", "user.email=test@example.com", "-c", "user.name=test"}, args...)
+		o, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(o))
+	}
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmp, name)), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(tmp, name), []byte(content), 0o600))
+	}
+
+	write("deep/deep.go", "package deep\n")
+	git("deep", "init", "-q")
+	git("deep", "add", ".")
+	git("deep", "commit", "-qm", "deep")
+
+	write("sub/go.mod", "module example.com/sub\n")
+	write("sub/lib.go", "package sub\n")
+	git("sub", "init", "-q")
+	git("sub", "submodule", "add", "-q", filepath.Join(tmp, "deep"), "deep")
+	git("sub", "add", ".")
+	git("sub", "commit", "-qm", "sub")
+
+	require.NoError(t, os.Mkdir(filepath.Join(tmp, "main"), 0o700))
+	git("main", "init", "-q")
+	git("main", "submodule", "add", "-q", filepath.Join(tmp, "sub"), "sub")
+	git("main", "submodule", "update", "-q", "--init", "--recursive")
+	git("main", "commit", "-qm", "main")
+
+	write("main/sub/lib.go", "package sub\n\nvar a = 1\n")
+	write("main/sub/deep/deep.go", "package deep\n\nvar b = 2\n")
+	git("main/sub/deep", "commit", "-qam", "deep change")
+	git("main/sub", "commit", "-qam", "sub change")
+
+	require.NoError(t, os.Chdir(filepath.Join(tmp, "main")))
+
+	defer func() {
+		require.NoError(t, os.Chdir(wd))
+	}()
+
+	// Pointer changes are detected regardless of diff.submodule config.
+	for _, format := range []string{"short", "log", "diff"} {
+		t.Run(format, func(t *testing.T) {
+			t.Setenv("GIT_CONFIG_COUNT", "1")
+			t.Setenv("GIT_CONFIG_KEY_0", "diff.submodule")
+			t.Setenv("GIT_CONFIG_VALUE_0", format)
+
+			d, err := getDiff(flags{base: "HEAD", diffMode: diffWorktree, submodules: true, root: filepath.Join(tmp, "main")})
+			require.NoError(t, err)
+
+			var names []string
+
+			for _, fd := range d.files {
+				names = append(names, fd.newName)
+
+				if fd.newName == "sub/lib.go" {
+					assert.Equal(t, diffLine{kind: lineAdded, newNum: 3, content: "var a = 1"}, fd.hunks[0].lines[2])
+				}
+			}
+
+			assert.Equal(t, []string{"sub/deep/deep.go", "sub/lib.go"}, names)
+			assert.Equal(t, []string{"sub", "sub/deep"}, d.submodules)
+
+			m := &pathMapper{root: filepath.Join(tmp, "main")}
+			for _, dir := range d.submodules {
+				m.addSubmodule(dir)
+			}
+
+			assert.Equal(t, "sub/lib.go", m.repoPath("example.com/sub/lib.go"))
+		})
+	}
+}
+
+func Test_expandSubmodules_deleted(t *testing.T) {
+	d, err := parseDiff(strings.NewReader(`diff --git a/sub b/sub
+deleted file mode 160000
+index 1f2e3d4..0000000
+--- a/sub
++++ /dev/null
+@@ -1 +0,0 @@
+-Subproject commit 1f2e3d4c5b6a79801f2e3d4c5b6a79801f2e3d4c
+diff --git a/notes.txt b/notes.txt
+index 5c6b7a8..9d8e7f6 100644
+--- a/notes.txt
++++ b/notes.txt
+@@ -1 +1 @@
+-Subproject commit 1f2e3d4c5b6a79801f2e3d4c5b6a79801f2e3d4c
++Subproject commit 5c6b7a89d8e7f6a55c6b7a89d8e7f6a55c6b7a89
+`))
+	require.NoError(t, err)
+
+	oldCommit, newCommit, ok := submodulePointer(d.files[0])
+	assert.True(t, ok)
+	assert.Equal(t, "1f2e3d4c5b6a79801f2e3d4c5b6a79801f2e3d4c", oldCommit)
+	assert.Equal(t, "", newCommit)
+
+	// Submodules are detected by file mode, not by content.
+	_, _, ok = submodulePointer(d.files[1])
+	assert.False(t, ok)
+
+	// Deleted submodule is not checked out, it is dropped without diff.
+	require.NoError(t, expandSubmodules(d, t.TempDir()))
+	require.Len(t, d.files, 1)
+	assert.Equal(t, "notes.txt", d.files[0].newName)
+	assert.Empty(t, d.submodules)
+}
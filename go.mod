@@ -4,9 +4,9 @@ go 1.17
 
 require (
 	github.com/bool64/dev v0.2.31
+	github.com/klauspost/compress v1.15.15
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/stretchr/testify v1.8.4
-	github.com/waigani/diffparser v0.0.0-20190828052634-7391f219313d
 )
 
 require (